@@ -0,0 +1,15 @@
+package cloudmeta
+
+// Account identifies who owns an instance. Fields that don't apply to a
+// provider are left empty.
+type Account struct {
+	// ID is the AWS account ID, GCP project ID, Azure subscription ID, OCI
+	// tenancy OCID or OpenStack project ID
+	ID string `json:"id,omitempty"`
+	// ProjectNumber is the numeric GCP project ID
+	ProjectNumber string `json:"project_number,omitempty"`
+	// ResourceGroup is the Azure resource group
+	ResourceGroup string `json:"resource_group,omitempty"`
+	// CompartmentID is the OCID of the OCI compartment
+	CompartmentID string `json:"compartment_id,omitempty"`
+}
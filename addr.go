@@ -0,0 +1,144 @@
+package cloudmeta
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+)
+
+// AddrError reports a metadata value that isn't an address, or not one of
+// the expected family. It unwraps to ErrInvalidAddress.
+type AddrError struct {
+	Provider string
+	// Field names the value, e.g. PrivateIPv4
+	Field string
+	Value string
+	// Want is the expected kind of value: IPv4 address, IPv6 address or
+	// IP prefix
+	Want string
+}
+
+func (e *AddrError) Error() string {
+	value := e.Value
+	if len(value) > 64 {
+		value = value[:64] + "..."
+	}
+	msg := fmt.Sprintf("%s: %s: %q is not an %s", e.Field, ErrInvalidAddress, value, e.Want)
+	if e.Provider != "" {
+		msg = e.Provider + ": " + msg
+	}
+	return msg
+}
+
+func (e *AddrError) Unwrap() error {
+	return ErrInvalidAddress
+}
+
+// PrivateIPv4Addr returns the private IPv4 address of the primary interface
+func PrivateIPv4Addr(ctx context.Context, p Provider) (netip.Addr, error) {
+	value, err := nonEmpty(p.GetPrivateIPv4(ctx))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return parseAddr(p.Name(), "PrivateIPv4", value, 4)
+}
+
+// PublicIPv4Addr returns the public IPv4 address of the primary interface
+func PublicIPv4Addr(ctx context.Context, p Provider) (netip.Addr, error) {
+	value, err := nonEmpty(p.GetPublicIPv4(ctx))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return parseAddr(p.Name(), "PublicIPv4", value, 4)
+}
+
+// PrimaryIPv6Addr returns the primary IPv6 address
+func PrimaryIPv6Addr(ctx context.Context, p Provider) (netip.Addr, error) {
+	value, err := nonEmpty(p.GetPrimaryIPv6(ctx))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return parseAddr(p.Name(), "PrimaryIPv6", value, 6)
+}
+
+// IPv6Addrs returns the IPv6 addresses of every interface. The provider
+// has to implement IPv6Provider.
+func IPv6Addrs(ctx context.Context, p Provider) ([]netip.Addr, error) {
+	ext, err := extension[IPv6Provider](p)
+	if err != nil {
+		return nil, err
+	}
+	values, err := ext.GetIPv6Addresses(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]netip.Addr, 0, len(values))
+	for _, value := range values {
+		addr, err := parseAddr(p.Name(), "IPv6Addresses", value, 6)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
+// IPv6Prefixes returns the IPv6 prefixes delegated to every interface. The
+// provider has to implement IPv6Provider.
+func IPv6Prefixes(ctx context.Context, p Provider) ([]netip.Prefix, error) {
+	ext, err := extension[IPv6Provider](p)
+	if err != nil {
+		return nil, err
+	}
+	values, err := ext.GetIPv6Prefixes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil || !prefix.Addr().Is6() || prefix.Addr().Is4In6() {
+			return nil, &AddrError{Provider: p.Name(), Field: "IPv6Prefixes", Value: value, Want: "IPv6 prefix"}
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, nil
+}
+
+// SubnetPrefix returns the subnet of the interface, or ErrNotFound when
+// the provider doesn't report it
+func (n NetworkInterface) SubnetPrefix() (netip.Prefix, error) {
+	if n.SubnetCIDR == "" {
+		return netip.Prefix{}, ErrNotFound
+	}
+
+	prefix, err := netip.ParsePrefix(n.SubnetCIDR)
+	if err != nil {
+		return netip.Prefix{}, &AddrError{Field: "SubnetCIDR", Value: n.SubnetCIDR, Want: "IP prefix"}
+	}
+	return prefix, nil
+}
+
+// parseAddr parses value as an address of the given family, 4 or 6. IPv4
+// addresses written as IPv4-mapped IPv6 are unmapped.
+func parseAddr(provider, field, value string, family int) (netip.Addr, error) {
+	want := "IPv4 address"
+	if family == 6 {
+		want = "IPv6 address"
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Addr{}, &AddrError{Provider: provider, Field: field, Value: value, Want: want}
+	}
+
+	switch {
+	case family == 4 && addr.Unmap().Is4():
+		return addr.Unmap(), nil
+	case family == 6 && addr.Is6() && !addr.Is4In6():
+		return addr, nil
+	}
+	return netip.Addr{}, &AddrError{Provider: provider, Field: field, Value: value, Want: want}
+}
@@ -0,0 +1,122 @@
+package cloudmeta
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/nickgarlis/go-cloudmeta/internal/test"
+)
+
+func TestParseAddr(t *testing.T) {
+	tests := []struct {
+		value  string
+		family int
+		want   string
+	}{
+		{"10.0.0.4", 4, "10.0.0.4"},
+		{"::ffff:10.0.0.4", 4, "10.0.0.4"},
+		{"2001:db8::1", 6, "2001:db8::1"},
+		{"2001:0db8:85a3:0000:0000:8a2e:0370:7334", 6, "2001:db8:85a3::8a2e:370:7334"},
+		{"2001:db8::1", 4, ""},
+		{"10.0.0.4", 6, ""},
+		{"::ffff:10.0.0.4", 6, ""},
+		{"<html><body>Bad Request</body></html>", 4, ""},
+	}
+
+	for _, tt := range tests {
+		addr, err := parseAddr("test", "Field", tt.value, tt.family)
+		if tt.want == "" {
+			var addrErr *AddrError
+			if !errors.As(err, &addrErr) || !errors.Is(err, ErrInvalidAddress) {
+				t.Errorf("parseAddr(%q, %d): expected AddrError, got %v", tt.value, tt.family, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseAddr(%q, %d): unexpected error: %v", tt.value, tt.family, err)
+			continue
+		}
+		if addr.String() != tt.want {
+			t.Errorf("parseAddr(%q, %d) = %s, want %s", tt.value, tt.family, addr, tt.want)
+		}
+	}
+}
+
+func TestTypedAddrs(t *testing.T) {
+	server := test.CreateMockAWSServer()
+	defer server.Close()
+
+	provider := NewAWSProvider(WithBaseURL(server.URL))
+	ctx := context.Background()
+
+	private, err := PrivateIPv4Addr(ctx, provider)
+	if err != nil || private != netip.MustParseAddr("10.0.1.100") {
+		t.Errorf("PrivateIPv4Addr() = %v, %v", private, err)
+	}
+
+	public, err := PublicIPv4Addr(ctx, provider)
+	if err != nil || public != netip.MustParseAddr("54.123.45.67") {
+		t.Errorf("PublicIPv4Addr() = %v, %v", public, err)
+	}
+
+	ipv6, err := PrimaryIPv6Addr(ctx, provider)
+	if err != nil || ipv6 != netip.MustParseAddr("2001:db8:85a3::8a2e:370:7334") {
+		t.Errorf("PrimaryIPv6Addr() = %v, %v", ipv6, err)
+	}
+
+	addrs, err := IPv6Addrs(ctx, provider)
+	want := []netip.Addr{netip.MustParseAddr("2001:db8:85a3::8a2e:370:7334")}
+	if err != nil || !reflect.DeepEqual(addrs, want) {
+		t.Errorf("IPv6Addrs() = %v, %v", addrs, err)
+	}
+
+	prefixes, err := IPv6Prefixes(ctx, provider)
+	wantPrefixes := []netip.Prefix{netip.MustParsePrefix("2600:1f14:abc:de00::/80")}
+	if err != nil || !reflect.DeepEqual(prefixes, wantPrefixes) {
+		t.Errorf("IPv6Prefixes() = %v, %v", prefixes, err)
+	}
+}
+
+func TestTypedAddrs_Invalid(t *testing.T) {
+	// Azure answering with an empty body and an error page
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata/instance/network/interface/0/ipv4/ipAddress/0/privateIpAddress":
+			w.Write([]byte("<html><body>Bad Request</body></html>"))
+		case "/metadata/instance/network/interface/0/ipv6/ipAddress/0/publicIpAddress":
+			w.Write([]byte("10.0.0.4"))
+		}
+	}))
+	defer server.Close()
+
+	provider := NewAzureProvider(WithBaseURL(server.URL))
+	ctx := context.Background()
+
+	if _, err := PrivateIPv4Addr(ctx, provider); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("Expected ErrInvalidAddress for an error page, got %v", err)
+	}
+	if _, err := PublicIPv4Addr(ctx, provider); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an empty body, got %v", err)
+	}
+	if _, err := PrimaryIPv6Addr(ctx, provider); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("Expected ErrInvalidAddress for an IPv4 address, got %v", err)
+	}
+}
+
+func TestNetworkInterface_SubnetPrefix(t *testing.T) {
+	prefix, err := NetworkInterface{SubnetCIDR: "10.0.1.0/24"}.SubnetPrefix()
+	if err != nil || prefix != netip.MustParsePrefix("10.0.1.0/24") {
+		t.Errorf("SubnetPrefix() = %v, %v", prefix, err)
+	}
+	if _, err := (NetworkInterface{}).SubnetPrefix(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := (NetworkInterface{SubnetCIDR: "10.0.1.0"}).SubnetPrefix(); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("Expected ErrInvalidAddress, got %v", err)
+	}
+}
@@ -2,9 +2,19 @@ package cloudmeta
 
 import (
 	"context"
-	"sync"
+	"fmt"
+	"time"
 )
 
+// defaultDetectTimeout bounds the total time spent detecting the provider
+// when the caller's context has no earlier deadline.
+const defaultDetectTimeout = 3 * time.Second
+
+// Provider is the interface every provider implements. It only holds what
+// every cloud serves and doesn't grow, so providers added with Register
+// keep compiling as accessors are added. Further metadata is exposed
+// through the optional interfaces below, which the built-in providers all
+// implement; check for them with a type assertion.
 type Provider interface {
 	Name() string
 	GetInstanceID(ctx context.Context) (string, error)
@@ -14,42 +24,120 @@ type Provider interface {
 	GetPrimaryIPv6(ctx context.Context) (string, error)
 }
 
-type detector func(ctx context.Context, baseURL ...string) Provider
+// PlacementProvider tells where the instance runs
+type PlacementProvider interface {
+	GetRegion(ctx context.Context) (string, error)
+	GetZone(ctx context.Context) (string, error)
+}
 
-var (
-	cachedProvider Provider
-	once           sync.Once
-)
+// MachineProvider tells the hardware profile and image of the instance
+type MachineProvider interface {
+	GetInstanceType(ctx context.Context) (string, error)
+	GetImageID(ctx context.Context) (string, error)
+}
+
+// AccountProvider tells who owns the instance
+type AccountProvider interface {
+	GetAccount(ctx context.Context) (*Account, error)
+}
+
+// TagsProvider reads the tags or labels of the instance
+type TagsProvider interface {
+	GetTags(ctx context.Context) (map[string]string, error)
+}
+
+// UserDataProvider reads the user data the instance was launched with
+type UserDataProvider interface {
+	GetUserData(ctx context.Context) ([]byte, error)
+}
+
+// SSHKeysProvider reads the SSH public keys provisioned for the instance.
+// GetSSHKeys returns ErrNotFound when the instance has no keys, and the
+// valid keys along with an ErrMalformedSSHKey error when some entries
+// don't parse.
+type SSHKeysProvider interface {
+	GetSSHKeys(ctx context.Context) ([]SSHKey, error)
+}
+
+// NetworkInterfacesProvider lists the NICs attached to the instance
+type NetworkInterfacesProvider interface {
+	GetNetworkInterfaces(ctx context.Context) ([]NetworkInterface, error)
+}
 
-// GetProvider retrieves the cloud provider, caching the result
+// IPv6Provider lists the IPv6 addresses and delegated prefixes of every
+// interface
+type IPv6Provider interface {
+	GetIPv6Addresses(ctx context.Context) ([]string, error)
+	GetIPv6Prefixes(ctx context.Context) ([]string, error)
+}
+
+// extension returns p as the optional interface T, or an error wrapping
+// ErrNotSupported if p doesn't implement it
+func extension[T any](p Provider) (T, error) {
+	ext, ok := p.(T)
+	if !ok {
+		return ext, fmt.Errorf("%s: %w", p.Name(), ErrNotSupported)
+	}
+	return ext, nil
+}
+
+var defaultDetector = NewDetector()
+
+// GetProvider retrieves the cloud provider using the default Detector,
+// caching the result once detection succeeds
 func GetProvider(ctx context.Context) (Provider, error) {
-	return getProvider(ctx)
-}
-
-// getProvider retrieves the cloud provider, caching the result
-func getProvider(ctx context.Context, baseURL ...string) (Provider, error) {
-	var err error
-	once.Do(func() {
-		cachedProvider, err = detectProvider(ctx, baseURL...)
-	})
-	return cachedProvider, err
-}
-
-// getProvider detects the cloud provider by trying each detector in order
-func detectProvider(ctx context.Context, baseURL ...string) (Provider, error) {
-	providers := []detector{
-		detectAWS,
-		detectGCP,
-		detectAzure,
-		detectOCI,
-		detectHetzner,
-		detectOpenStack,
-		detectDigitalOcean,
+	return defaultDetector.Detect(ctx)
+}
+
+// detectFirst runs all detectors concurrently and returns the result of the
+// earliest detector in the list that found a provider or failed with an
+// error. Detectors that can no longer win are cancelled as soon as a higher
+// priority one answers.
+func detectFirst(ctx context.Context, detectors []DetectFunc, opts ...Option) (Provider, error) {
+	type result struct {
+		index    int
+		provider Provider
+		err      error
+	}
+
+	results := make(chan result, len(detectors))
+	cancels := make([]context.CancelFunc, len(detectors))
+	for i, d := range detectors {
+		probeCtx, cancel := context.WithCancel(ctx)
+		cancels[i] = cancel
+		go func() {
+			p, err := d(probeCtx, opts...)
+			results <- result{index: i, provider: p, err: err}
+		}()
 	}
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+	}()
+
+	found := make([]*result, len(detectors))
+	next := 0 // lowest index whose result is still pending or unchecked
+
+	for range detectors {
+		select {
+		case r := <-results:
+			found[r.index] = &r
+			if r.provider != nil || r.err != nil {
+				// Lower priority detectors can't win anymore
+				for _, cancel := range cancels[r.index+1:] {
+					cancel()
+				}
+			}
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %w", ErrUnknownProvider, ctx.Err())
+		}
 
-	for _, d := range providers {
-		if p := d(ctx, baseURL...); p != nil {
-			return p, nil
+		for next < len(detectors) && found[next] != nil {
+			if r := found[next]; r.provider != nil || r.err != nil {
+				return r.provider, r.err
+			}
+			next++
 		}
 	}
 
@@ -2,24 +2,19 @@ package cloudmeta
 
 import (
 	"context"
-	"sync"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/nickgarlis/go-cloudmeta/internal/test"
 )
 
-func resetCache() {
-	cachedProvider = nil
-	once = sync.Once{}
-}
-
 func TestGetProviderAWS(t *testing.T) {
-	resetCache()
-
 	mockServer := test.CreateMockAWSServer(false)
 	defer mockServer.Close()
 
-	provider, err := getProvider(context.TODO(), mockServer.URL)
+	detector := NewDetector(WithBaseURL(mockServer.URL), WithDMIRoot(""))
+	provider, err := detector.Detect(context.TODO())
 	if err != nil {
 		t.Fatalf("Failed to get provider: %v", err)
 	}
@@ -41,12 +36,11 @@ func TestGetProviderAWS(t *testing.T) {
 }
 
 func TestGetProviderGCP(t *testing.T) {
-	resetCache()
-
 	mockServer := test.CreateMockGCPServer()
 	defer mockServer.Close()
 
-	provider, err := getProvider(context.TODO(), mockServer.URL)
+	detector := NewDetector(WithBaseURL(mockServer.URL), WithDMIRoot(""))
+	provider, err := detector.Detect(context.TODO())
 	if err != nil {
 		t.Fatalf("Failed to get provider: %v", err)
 	}
@@ -66,3 +60,222 @@ func TestGetProviderGCP(t *testing.T) {
 		t.Fatalf("Expected provider type *GCPProvider, got %T", p)
 	}
 }
+
+func TestDetectFirstPriority(t *testing.T) {
+	slowAWS := func(ctx context.Context, opts ...Option) (Provider, error) {
+		time.Sleep(50 * time.Millisecond)
+		return &AWSProvider{}, nil
+	}
+	fastOpenStack := func(ctx context.Context, opts ...Option) (Provider, error) {
+		return &OpenStackProvider{}, nil
+	}
+
+	provider, err := detectFirst(context.TODO(), []DetectFunc{slowAWS, fastOpenStack})
+	if err != nil {
+		t.Fatalf("Failed to detect provider: %v", err)
+	}
+
+	if provider.Name() != "aws" {
+		t.Fatalf("Expected provider 'aws', got '%s'", provider.Name())
+	}
+}
+
+func TestDetectFirstCancelsLosers(t *testing.T) {
+	cancelled := make(chan struct{})
+	aws := func(ctx context.Context, opts ...Option) (Provider, error) {
+		return &AWSProvider{}, nil
+	}
+	blocking := func(ctx context.Context, opts ...Option) (Provider, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, nil
+	}
+
+	provider, err := detectFirst(context.TODO(), []DetectFunc{aws, blocking})
+	if err != nil {
+		t.Fatalf("Failed to detect provider: %v", err)
+	}
+
+	if provider.Name() != "aws" {
+		t.Fatalf("Expected provider 'aws', got '%s'", provider.Name())
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("Lower priority detector was not cancelled")
+	}
+}
+
+func TestDetectFirstDeadline(t *testing.T) {
+	blocking := func(ctx context.Context, opts ...Option) (Provider, error) {
+		time.Sleep(time.Second)
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := detectFirst(ctx, []DetectFunc{blocking, blocking})
+	if !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("Expected ErrUnknownProvider, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("Detection ignored the deadline, took %s", elapsed)
+	}
+}
+
+func TestDetectorCachePolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      CachePolicy
+		expectRetry bool
+	}{
+		{name: "cache success", policy: CacheSuccess, expectRetry: true},
+		{name: "cache all", policy: CacheAll, expectRetry: false},
+		{name: "cache none", policy: CacheNone, expectRetry: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := test.CreateMockGCPServer(true)
+			defer mockServer.Close()
+
+			detector := NewDetector(
+				WithBaseURL(mockServer.URL),
+				WithDMIRoot(""),
+				WithProviders("gcp"),
+				WithCachePolicy(tt.policy),
+			)
+
+			if _, err := detector.Detect(context.TODO()); !errors.Is(err, ErrUnknownProvider) {
+				t.Fatalf("Expected ErrUnknownProvider, got %v", err)
+			}
+
+			// The metadata service recovers
+			mockServer.Config.Handler = test.CreateMockGCPServer().Config.Handler
+
+			provider, err := detector.Detect(context.TODO())
+			if tt.expectRetry {
+				if err != nil {
+					t.Fatalf("Expected detection to be retried, got %v", err)
+				}
+				if provider.Name() != "gcp" {
+					t.Fatalf("Expected provider 'gcp', got '%s'", provider.Name())
+				}
+			} else if !errors.Is(err, ErrUnknownProvider) {
+				t.Fatalf("Expected cached ErrUnknownProvider, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDetectorProviderFilters(t *testing.T) {
+	mockServer := test.CreateMockGCPServer()
+	defer mockServer.Close()
+
+	detector := NewDetector(WithBaseURL(mockServer.URL), WithDMIRoot(""), WithoutProviders("gcp"))
+	if _, err := detector.Detect(context.TODO()); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("Expected ErrUnknownProvider, got %v", err)
+	}
+
+	detector = NewDetector(WithBaseURL(mockServer.URL), WithDMIRoot(""), WithProviders("aws", "gcp"))
+	provider, err := detector.Detect(context.TODO())
+	if err != nil {
+		t.Fatalf("Failed to detect provider: %v", err)
+	}
+	if provider.Name() != "gcp" {
+		t.Fatalf("Expected provider 'gcp', got '%s'", provider.Name())
+	}
+}
+
+func TestDetectorEnvOverride(t *testing.T) {
+	mockServer := test.CreateMockGCPServer()
+	defer mockServer.Close()
+
+	t.Setenv(EnvProvider, "gcp")
+	t.Setenv(EnvEndpoint, mockServer.URL)
+
+	provider, err := NewDetector(WithDMIRoot("")).Detect(context.TODO())
+	if err != nil {
+		t.Fatalf("Failed to get provider: %v", err)
+	}
+	if provider.Name() != "gcp" {
+		t.Fatalf("Expected provider 'gcp', got '%s'", provider.Name())
+	}
+
+	id, err := provider.GetInstanceID(context.TODO())
+	if err != nil {
+		t.Fatalf("Failed to get instance ID from endpoint override: %v", err)
+	}
+	if id != "1234567890123456789" {
+		t.Fatalf("Expected instance ID '1234567890123456789', got '%s'", id)
+	}
+
+	t.Setenv(EnvProvider, "none")
+	if _, err := NewDetector(WithDMIRoot("")).Detect(context.TODO()); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("Expected ErrUnknownProvider, got %v", err)
+	}
+
+	// Options take precedence over the environment
+	provider, err = NewDetector(WithDMIRoot(""), WithForcedProvider("")).Detect(context.TODO())
+	if err != nil {
+		t.Fatalf("Failed to get provider: %v", err)
+	}
+	if provider.Name() != "gcp" {
+		t.Fatalf("Expected provider 'gcp', got '%s'", provider.Name())
+	}
+}
+
+func TestDetectorEnvReadOnDetect(t *testing.T) {
+	// Like the default detector, created before the environment is set
+	detector := NewDetector(WithDMIRoot(""), WithCachePolicy(CacheNone))
+
+	t.Setenv(EnvProvider, "none")
+	if _, err := detector.Detect(context.TODO()); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("Expected ErrUnknownProvider, got %v", err)
+	}
+
+	t.Setenv(EnvProvider, "gcp")
+	provider, err := detector.Detect(context.TODO())
+	if err != nil {
+		t.Fatalf("Failed to get provider: %v", err)
+	}
+	if provider.Name() != "gcp" {
+		t.Fatalf("Expected provider 'gcp', got '%s'", provider.Name())
+	}
+}
+
+func TestDetectorForcedProviderUnknown(t *testing.T) {
+	_, err := NewDetector(WithForcedProvider("nimbus")).Detect(context.TODO())
+	if !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("Expected ErrUnknownProvider, got %v", err)
+	}
+}
+
+func TestBuiltinProvidersImplementExtensions(t *testing.T) {
+	for name, newProvider := range constructors {
+		p := newProvider()
+		for _, ok := range []bool{
+			implements[PlacementProvider](p),
+			implements[MachineProvider](p),
+			implements[AccountProvider](p),
+			implements[TagsProvider](p),
+			implements[UserDataProvider](p),
+			implements[SSHKeysProvider](p),
+			implements[NetworkInterfacesProvider](p),
+			implements[IPv6Provider](p),
+		} {
+			if !ok {
+				t.Errorf("%s doesn't implement every optional interface", name)
+			}
+		}
+	}
+}
+
+func implements[T any](p Provider) bool {
+	_, ok := p.(T)
+	return ok
+}
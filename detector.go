@@ -0,0 +1,167 @@
+package cloudmeta
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Detector detects the cloud provider the host runs on. Unlike GetProvider,
+// each Detector has its own settings and cache.
+type Detector struct {
+	opts []Option
+
+	mu       sync.Mutex
+	cached   bool
+	provider Provider
+	err      error
+}
+
+// NewDetector creates a Detector. The options are also passed on to the
+// providers it creates. The environment variables are read on every
+// detection, not when the Detector is created.
+func NewDetector(opts ...Option) *Detector {
+	return &Detector{opts: opts}
+}
+
+// Detect returns the cloud provider, reusing a cached result according to
+// the Detector's CachePolicy
+func (d *Detector) Detect(ctx context.Context) (Provider, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cached {
+		return d.provider, d.err
+	}
+
+	cfg := newConfig(d.opts...)
+	provider, err := d.detect(ctx, cfg, nil)
+
+	switch cfg.cachePolicy {
+	case CacheAll:
+		d.cached = true
+	case CacheSuccess:
+		d.cached = err == nil
+	}
+	if d.cached {
+		d.provider, d.err = provider, err
+	}
+
+	return provider, err
+}
+
+// Reset clears the cached result so the next call to Detect probes again
+func (d *Detector) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.cached = false
+	d.provider, d.err = nil, nil
+}
+
+// detect returns the forced provider if one is set, or else probes every
+// enabled detector. If the DMI fields identify the platform, only its
+// detector is probed first and the others are only tried when it doesn't
+// answer. When rep is not nil, every probe is recorded in it.
+func (d *Detector) detect(ctx context.Context, cfg *config, rep *Report) (Provider, error) {
+	if cfg.forced != "" {
+		if rep != nil {
+			rep.Forced = true
+		}
+		return d.forcedProvider(ctx, cfg.forced)
+	}
+
+	if cfg.detectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.detectTimeout)
+		defer cancel()
+	}
+
+	dmi := readDMI(cfg.dmiRoot).provider()
+
+	registrations := registered()
+	var wg sync.WaitGroup
+	if rep != nil {
+		rep.DMI = dmi
+		rep.Candidates = make([]Candidate, len(registrations))
+		// Losers keep running briefly after being cancelled
+		defer wg.Wait()
+	}
+
+	var first DetectFunc
+	probes := make([]DetectFunc, 0, len(registrations))
+	for i, r := range registrations {
+		probe := withProbeTimeout(r.detect, cfg.probeTimeout)
+		if rep != nil {
+			c := &rep.Candidates[i]
+			c.Name, c.Priority = r.Name, r.Priority
+			if r.Name == dmi {
+				c.Signals = append(c.Signals, "dmi")
+			}
+			probe = c.record(probe, &wg)
+		}
+
+		switch {
+		case !cfg.enabled(r.Name):
+		case r.Name == dmi:
+			first = probe
+		default:
+			probes = append(probes, probe)
+		}
+	}
+
+	if first != nil {
+		if rep != nil {
+			wg.Add(1)
+		}
+		if p, err := first(ctx, d.opts...); p != nil || err != nil {
+			return p, err
+		}
+	}
+
+	if rep != nil {
+		wg.Add(len(probes))
+	}
+	return detectFirst(ctx, probes, d.opts...)
+}
+
+// forcedProvider returns the provider named by WithForcedProvider or the
+// CLOUDMETA_PROVIDER environment variable. Built-in providers are created
+// without probing, even when unregistered; registered ones, including those
+// replacing a built-in provider, are probed on their own.
+func (d *Detector) forcedProvider(ctx context.Context, name string) (Provider, error) {
+	if name == "none" {
+		return nil, ErrUnknownProvider
+	}
+
+	for _, r := range registered() {
+		if r.Name != name || r.builtin {
+			continue
+		}
+		p, err := r.detect(ctx, d.opts...)
+		if p == nil && err == nil {
+			err = ErrUnknownProvider
+		}
+		return p, err
+	}
+
+	if newProvider, ok := constructors[name]; ok {
+		return newProvider(d.opts...), nil
+	}
+	return nil, fmt.Errorf("%w: %q is not registered", ErrUnknownProvider, name)
+}
+
+// withProbeTimeout limits how long the detector may take to answer. It
+// also marks the probe's requests so they aren't retried.
+func withProbeTimeout(detect DetectFunc, timeout time.Duration) DetectFunc {
+	return func(ctx context.Context, opts ...Option) (Provider, error) {
+		ctx = withProbe(ctx)
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return detect(ctx, opts...)
+	}
+}
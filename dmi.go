@@ -0,0 +1,70 @@
+package cloudmeta
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// azureAssetTag is the chassis asset tag set on every Azure virtual machine
+const azureAssetTag = "7783-7084-3265-9085-8269-3286-77"
+
+// defaultDMIRoot is the sysfs directory the SMBIOS/DMI fields are read from
+const defaultDMIRoot = "/sys/class/dmi/id"
+
+// dmiInfo holds the SMBIOS/DMI fields used to recognize a platform
+type dmiInfo struct {
+	sysVendor       string
+	productName     string
+	boardVendor     string
+	chassisAssetTag string
+	biosVendor      string
+}
+
+// readDMI reads the DMI fields below root. Missing or unreadable fields are
+// left empty, so hosts without sysfs simply yield no match.
+func readDMI(root string) dmiInfo {
+	if root == "" {
+		return dmiInfo{}
+	}
+
+	read := func(name string) string {
+		b, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(b))
+	}
+
+	return dmiInfo{
+		sysVendor:       read("sys_vendor"),
+		productName:     read("product_name"),
+		boardVendor:     read("board_vendor"),
+		chassisAssetTag: read("chassis_asset_tag"),
+		biosVendor:      read("bios_vendor"),
+	}
+}
+
+// provider returns the name of the provider the DMI fields point to, or an
+// empty string if they don't match any known platform
+func (d dmiInfo) provider() string {
+	switch {
+	case d.sysVendor == "Amazon EC2", d.boardVendor == "Amazon EC2",
+		strings.HasPrefix(d.biosVendor, "Amazon"):
+		return "aws"
+	case d.sysVendor == "Google", d.productName == "Google Compute Engine":
+		return "gcp"
+	case d.chassisAssetTag == azureAssetTag:
+		return "azure"
+	case d.chassisAssetTag == "OracleCloud.com":
+		return "oci"
+	case d.sysVendor == "DigitalOcean":
+		return "digitalocean"
+	case d.sysVendor == "Hetzner":
+		return "hetzner"
+	case strings.HasPrefix(d.productName, "OpenStack"), d.sysVendor == "OpenStack Foundation":
+		// Nova reports "OpenStack Nova" or "OpenStack Compute"
+		return "openstack"
+	}
+	return ""
+}
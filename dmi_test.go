@@ -0,0 +1,111 @@
+package cloudmeta
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nickgarlis/go-cloudmeta/internal/test"
+)
+
+func writeDMI(t *testing.T, fields map[string]string) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for name, value := range fields {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(value+"\n"), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return root
+}
+
+func TestDMIProvider(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]string
+		want   string
+	}{
+		{
+			name:   "aws nitro",
+			fields: map[string]string{"sys_vendor": "Amazon EC2", "product_name": "m5.large"},
+			want:   "aws",
+		},
+		{
+			name:   "aws xen",
+			fields: map[string]string{"sys_vendor": "Xen", "bios_vendor": "Amazon EC2"},
+			want:   "aws",
+		},
+		{
+			name:   "gcp",
+			fields: map[string]string{"sys_vendor": "Google", "product_name": "Google Compute Engine"},
+			want:   "gcp",
+		},
+		{
+			name:   "azure",
+			fields: map[string]string{"sys_vendor": "Microsoft Corporation", "chassis_asset_tag": azureAssetTag},
+			want:   "azure",
+		},
+		{
+			name:   "hyper-v outside azure",
+			fields: map[string]string{"sys_vendor": "Microsoft Corporation", "product_name": "Virtual Machine"},
+			want:   "",
+		},
+		{
+			name:   "digitalocean",
+			fields: map[string]string{"sys_vendor": "DigitalOcean", "product_name": "Droplet"},
+			want:   "digitalocean",
+		},
+		{
+			name:   "hetzner",
+			fields: map[string]string{"sys_vendor": "Hetzner", "product_name": "vServer"},
+			want:   "hetzner",
+		},
+		{
+			name:   "oci",
+			fields: map[string]string{"sys_vendor": "QEMU", "chassis_asset_tag": "OracleCloud.com"},
+			want:   "oci",
+		},
+		{
+			name:   "openstack",
+			fields: map[string]string{"sys_vendor": "OpenStack Foundation", "product_name": "OpenStack Nova"},
+			want:   "openstack",
+		},
+		{
+			name:   "bare metal",
+			fields: map[string]string{"sys_vendor": "Dell Inc.", "product_name": "PowerEdge R640"},
+			want:   "",
+		},
+		{
+			name:   "no sysfs",
+			fields: nil,
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeDMI(t, tt.fields)
+			if got := readDMI(root).provider(); got != tt.want {
+				t.Errorf("provider() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectProviderDMI(t *testing.T) {
+	root := writeDMI(t, map[string]string{"sys_vendor": "Google", "product_name": "Google Compute Engine"})
+	mockServer := test.CreateMockGCPServer()
+	defer mockServer.Close()
+
+	detector := NewDetector(WithBaseURL(mockServer.URL), WithDMIRoot(root))
+	provider, err := detector.Detect(context.TODO())
+	if err != nil {
+		t.Fatalf("Failed to detect provider: %v", err)
+	}
+
+	if provider.Name() != "gcp" {
+		t.Fatalf("Expected provider 'gcp', got '%s'", provider.Name())
+	}
+}
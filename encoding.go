@@ -0,0 +1,408 @@
+package cloudmeta
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// errorKinds names the sentinel errors in the JSON encoding. The more
+// specific ones come first.
+var errorKinds = []struct {
+	name string
+	err  error
+}{
+	{"tags_disabled", ErrTagsDisabled},
+	{"imds_hop_limit", ErrIMDSHopLimit},
+	{"malformed_ssh_key", ErrMalformedSSHKey},
+	{"invalid_address", ErrInvalidAddress},
+	{"not_found", ErrNotFound},
+	{"unauthorized", ErrUnauthorized},
+	{"throttled", ErrThrottled},
+	{"unavailable", ErrUnavailable},
+	{"not_supported", ErrNotSupported},
+}
+
+type jsonError struct {
+	Message string `json:"message"`
+	Kind    string `json:"kind,omitempty"`
+}
+
+// loadedError is an error read back from JSON. It unwraps to the sentinel
+// error the original wrapped.
+type loadedError struct {
+	message string
+	kind    error
+}
+
+func (e *loadedError) Error() string {
+	return e.message
+}
+
+func (e *loadedError) Unwrap() error {
+	return e.kind
+}
+
+// metadataFields is Metadata without its methods, so the encoding/json
+// defaults apply to it
+type metadataFields Metadata
+
+type metadataJSON struct {
+	*metadataFields
+	Errors map[string]jsonError `json:"errors,omitempty"`
+}
+
+// MarshalJSON encodes the metadata with the snake_case names of its json
+// tags. Errors are encoded under "errors", keyed by the JSON name of the
+// field:
+//
+//	"errors": {"public_ipv4": {"message": "...", "kind": "not_found"}}
+//
+// kind names the sentinel error the error wraps, if any: not_found,
+// unauthorized, throttled, unavailable, not_supported, tags_disabled,
+// imds_hop_limit, malformed_ssh_key or invalid_address.
+//
+// The receiver is a value so that Errors are kept when a Metadata, rather
+// than a pointer to one, is marshaled.
+func (m Metadata) MarshalJSON() ([]byte, error) {
+	out := metadataJSON{metadataFields: (*metadataFields)(&m)}
+	for _, f := range snapshotFields {
+		err := m.Errors[f.name]
+		if err == nil {
+			continue
+		}
+
+		e := jsonError{Message: err.Error()}
+		for _, kind := range errorKinds {
+			if errors.Is(err, kind.err) {
+				e.Kind = kind.name
+				break
+			}
+		}
+		if out.Errors == nil {
+			out.Errors = make(map[string]jsonError)
+		}
+		out.Errors[f.key] = e
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes metadata encoded by MarshalJSON. Errors are
+// restored with their messages and wrap the same sentinel errors.
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	*m = Metadata{}
+	in := metadataJSON{metadataFields: (*metadataFields)(m)}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	m.Errors = make(map[string]error, len(in.Errors))
+	for _, f := range snapshotFields {
+		e, ok := in.Errors[f.key]
+		if !ok {
+			continue
+		}
+
+		loaded := &loadedError{message: e.Message}
+		for _, kind := range errorKinds {
+			if kind.name == e.Kind {
+				loaded.kind = kind.err
+			}
+		}
+		m.Errors[f.name] = loaded
+	}
+	return nil
+}
+
+// YAML encodes the metadata as a YAML document with the same structure and
+// field names as its JSON form. Strings are always double quoted, so that
+// values such as "no" or "0123" keep their type, and so are keys that
+// aren't plain strings under YAML 1.1, such as tag names like "yes" or "123".
+func (m *Metadata) YAML() ([]byte, error) {
+	tree, err := m.tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	writeYAML(&b, tree, 0)
+	return b.Bytes(), nil
+}
+
+// Env encodes the metadata as KEY=value lines, as read by shells and
+// systemd's EnvironmentFile. Keys are the JSON names upper cased and
+// prefixed with CLOUD_, e.g. CLOUD_PRIVATE_IPV4. Lists of strings are
+// space separated, while other nested values are flattened with their
+// index or name, e.g. CLOUD_NETWORK_INTERFACES_0_MAC or CLOUD_TAGS_NAME.
+// Characters other than letters and digits in names, such as the dashes of
+// tag names, are replaced with underscores; keys that end up with the same
+// name, such as the tags foo-bar and foo_bar, are an error. Values are
+// single quoted when needed. Errors aren't included.
+func (m *Metadata) Env() ([]byte, error) {
+	tree, err := m.tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	seen := make(map[string]string)
+	for _, entry := range tree.entries {
+		if entry.key == "errors" {
+			continue
+		}
+		if err := writeEnv(&b, seen, "CLOUD_"+envName(entry.key), entry.key, entry.value); err != nil {
+			return nil, err
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// node is a decoded JSON value that keeps the order of object keys
+type node struct {
+	// scalar is the JSON text of a string, number, boolean or null
+	scalar  string
+	object  bool
+	entries []entry // members of an object
+	items   []*node // elements of an array
+}
+
+type entry struct {
+	key   string
+	value *node
+}
+
+// tree returns the JSON form of the metadata as a node
+func (m *Metadata) tree() (*node, error) {
+	data, err := m.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return decodeNode(dec)
+}
+
+func decodeNode(dec *json.Decoder) (*node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		n := &node{object: true}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.entries = append(n.entries, entry{key.(string), value})
+		}
+		_, err := dec.Token()
+		return n, err
+
+	case json.Delim('['):
+		n := &node{items: []*node{}}
+		for dec.More() {
+			value, err := decodeNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, value)
+		}
+		_, err := dec.Token()
+		return n, err
+	}
+
+	switch v := tok.(type) {
+	case string:
+		return &node{scalar: quoteJSON(v)}, nil
+	case json.Number:
+		return &node{scalar: v.String()}, nil
+	case nil:
+		return &node{scalar: "null"}, nil
+	}
+	return &node{scalar: fmt.Sprint(tok)}, nil
+}
+
+// quoteJSON returns s as a JSON string. JSON escapes are valid in YAML
+// double quoted scalars.
+func quoteJSON(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// string returns the value of a scalar node
+func (n *node) string() string {
+	var s string
+	if err := json.Unmarshal([]byte(n.scalar), &s); err != nil {
+		return n.scalar
+	}
+	return s
+}
+
+func (n *node) empty() bool {
+	if n.object {
+		return len(n.entries) == 0
+	}
+	return n.items != nil && len(n.items) == 0
+}
+
+func (n *node) collection() bool {
+	return n.object || n.items != nil
+}
+
+// writeYAML writes the members of an object, or the elements of an array,
+// at the given indentation. Scalars are written by the caller.
+func writeYAML(b *bytes.Buffer, n *node, indent int) {
+	pad := strings.Repeat("  ", indent)
+
+	if n.object {
+		for _, e := range n.entries {
+			b.WriteString(pad + yamlKey(e.key) + ":")
+			writeYAMLValue(b, e.value, indent+1)
+		}
+		return
+	}
+
+	for _, item := range n.items {
+		b.WriteString(pad + "-")
+		if !item.object || item.empty() {
+			writeYAMLValue(b, item, indent+1)
+			continue
+		}
+
+		// The first member of an object goes on the line of the dash
+		first := &node{object: true, entries: item.entries[:1]}
+		rest := &node{object: true, entries: item.entries[1:]}
+		b.WriteString(" ")
+		var line bytes.Buffer
+		writeYAML(&line, first, indent+1)
+		b.WriteString(strings.TrimLeft(line.String(), " "))
+		writeYAML(b, rest, indent+1)
+	}
+}
+
+// writeYAMLValue writes a value following a key or dash
+func writeYAMLValue(b *bytes.Buffer, n *node, indent int) {
+	switch {
+	case n.empty() && n.object:
+		b.WriteString(" {}\n")
+	case n.empty():
+		b.WriteString(" []\n")
+	case n.collection():
+		b.WriteString("\n")
+		writeYAML(b, n, indent)
+	default:
+		b.WriteString(" " + n.scalar + "\n")
+	}
+}
+
+// yamlWords are the plain scalars YAML 1.1 reads as booleans or null,
+// compared case insensitively
+var yamlWords = []string{"y", "yes", "n", "no", "true", "false", "on", "off", "null"}
+
+// yamlKey quotes keys that a YAML 1.1 parser wouldn't read back as the same
+// string: tag names with colons or spaces, keys that don't start with a
+// letter, such as 123 or ~, and words such as yes, off or null
+func yamlKey(key string) string {
+	if !plainYAMLKey(key) {
+		return quoteJSON(key)
+	}
+	return key
+}
+
+func plainYAMLKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	if c := key[0]; !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_') {
+		return false
+	}
+	if strings.IndexFunc(key, func(r rune) bool {
+		return !isAlnum(r) && r != '_' && r != '-' && r != '.' && r != '/'
+	}) >= 0 {
+		return false
+	}
+	return !slices.ContainsFunc(yamlWords, func(w string) bool { return strings.EqualFold(w, key) })
+}
+
+// writeEnv writes the variables for a value. Arrays of scalars are joined
+// with spaces; arrays of objects and objects are flattened. path is the
+// JSON path of the value, and seen maps the names written so far to theirs.
+func writeEnv(b *bytes.Buffer, seen map[string]string, name, path string, n *node) error {
+	switch {
+	case n.object:
+		for _, e := range n.entries {
+			if err := writeEnv(b, seen, name+"_"+envName(e.key), path+"."+e.key, e.value); err != nil {
+				return err
+			}
+		}
+
+	case n.items != nil:
+		var values []string
+		for i, item := range n.items {
+			if item.collection() {
+				if err := writeEnv(b, seen, fmt.Sprintf("%s_%d", name, i), fmt.Sprintf("%s.%d", path, i), item); err != nil {
+					return err
+				}
+				continue
+			}
+			values = append(values, item.string())
+		}
+		if values != nil {
+			return writeEnvLine(b, seen, name, path, strings.Join(values, " "))
+		}
+
+	default:
+		return writeEnvLine(b, seen, name, path, n.string())
+	}
+	return nil
+}
+
+func writeEnvLine(b *bytes.Buffer, seen map[string]string, name, path, value string) error {
+	if other, ok := seen[name]; ok {
+		return fmt.Errorf("env: %s and %s are both encoded as %s", other, path, name)
+	}
+	seen[name] = path
+	b.WriteString(name + "=" + shellQuote(value) + "\n")
+	return nil
+}
+
+// envName upper cases a key and replaces characters that aren't allowed
+// in variable names
+func envName(key string) string {
+	return strings.ToUpper(strings.Map(func(r rune) rune {
+		if isAlnum(r) {
+			return r
+		}
+		return '_'
+	}, key))
+}
+
+// shellQuote single quotes s unless it only holds characters that are safe
+// unquoted. A single quote in s ends the quoting, is escaped with a
+// backslash and starts it again.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !isAlnum(r) && !strings.ContainsRune("_-.,:/@%+=", r)
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func isAlnum(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
@@ -0,0 +1,214 @@
+package cloudmeta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nickgarlis/go-cloudmeta/internal/test"
+)
+
+func testMetadata(t *testing.T) *Metadata {
+	t.Helper()
+
+	server := test.CreateMockGCPServer()
+	defer server.Close()
+
+	m, err := Snapshot(context.Background(), NewGCPProvider(WithBaseURL(server.URL)))
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	m.PublicIPv4 = ""
+	m.Errors["PublicIPv4"] = &MetadataError{Provider: "gcp", Method: "GET", Path: "/public-ip", StatusCode: 404, Err: ErrNotFound}
+	m.Tags["aws:name"] = "it's web"
+	return m
+}
+
+func TestMetadata_JSON(t *testing.T) {
+	m := testMetadata(t)
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	for _, want := range []string{
+		`"provider":"gcp"`,
+		`"private_ipv4":"10.128.0.5"`,
+		`"project_number":"123456789012"`,
+		`"device_index":1`,
+		`"errors":{"public_ipv4":{"message":"gcp: GET /public-ip: HTTP 404: not found","kind":"not_found"}}`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("json.Marshal() = %s, missing %s", data, want)
+		}
+	}
+
+	var loaded Metadata
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	err = loaded.Errors["PublicIPv4"]
+	if !errors.Is(err, ErrNotFound) || err.Error() != m.Errors["PublicIPv4"].Error() {
+		t.Errorf("loaded Errors[PublicIPv4] = %v, want %v", err, m.Errors["PublicIPv4"])
+	}
+	loaded.Errors, m.Errors = nil, nil
+	if !reflect.DeepEqual(&loaded, m) {
+		t.Errorf("loaded = %+v, want %+v", &loaded, m)
+	}
+}
+
+func TestMetadata_JSONValue(t *testing.T) {
+	m := testMetadata(t)
+
+	data, err := json.Marshal(struct{ Metadata Metadata }{*m})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if want := `"errors":{"public_ipv4":`; !strings.Contains(string(data), want) {
+		t.Errorf("json.Marshal() = %s, missing %s", data, want)
+	}
+}
+
+func TestMetadata_YAML(t *testing.T) {
+	data, err := testMetadata(t).YAML()
+	if err != nil {
+		t.Fatalf("YAML() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"provider: \"gcp\"\ninstance_id: \"1234567890123456789\"\n",
+		"account:\n  id: \"my-test-project\"\n  project_number: \"123456789012\"\n",
+		"tags:\n  \"aws:name\": \"it's web\"\n",
+		"ipv6_addresses:\n  - \"2001:db8:85a3::8a2e:370:7334\"\n",
+		"network_interfaces:\n  - mac: \"42:01:0a:80:00:05\"\n    device_index: 0\n    private_ipv4s:\n      - \"10.128.0.5\"\n",
+		"  - mac: \"42:01:0a:81:00:02\"\n    device_index: 1\n",
+		"errors:\n  public_ipv4:\n    message: \"gcp: GET /public-ip: HTTP 404: not found\"\n    kind: \"not_found\"\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("YAML() = %s\nmissing %q", data, want)
+		}
+	}
+}
+
+func TestMetadata_Env(t *testing.T) {
+	data, err := testMetadata(t).Env()
+	if err != nil {
+		t.Fatalf("Env() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	for _, want := range []string{
+		"CLOUD_PROVIDER=gcp",
+		"CLOUD_PRIVATE_IPV4=10.128.0.5",
+		"CLOUD_ACCOUNT_PROJECT_NUMBER=123456789012",
+		`CLOUD_TAGS_AWS_NAME='it'\''s web'`,
+		"CLOUD_SSH_KEYS_1_USER=bob",
+		"CLOUD_NETWORK_INTERFACES_0_PRIVATE_IPV4S='10.128.0.5 10.128.0.6'",
+		"CLOUD_NETWORK_INTERFACES_1_DEVICE_INDEX=1",
+	} {
+		if !strings.Contains(string(data), want+"\n") {
+			t.Errorf("Env() = %s\nmissing %s", data, want)
+		}
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "CLOUD_PUBLIC_IPV4=") || strings.HasPrefix(line, "CLOUD_ERRORS") {
+			t.Errorf("Env() has unexpected line %s", line)
+		}
+	}
+}
+
+func TestMetadata_EnvCollision(t *testing.T) {
+	m := testMetadata(t)
+	m.Tags["foo-bar"] = "a"
+	m.Tags["foo_bar"] = "b"
+
+	_, err := m.Env()
+	if err == nil || !strings.Contains(err.Error(), "CLOUD_TAGS_FOO_BAR") {
+		t.Errorf("Env() error = %v, want a collision on CLOUD_TAGS_FOO_BAR", err)
+	}
+}
+
+func TestYAMLKey(t *testing.T) {
+	tt := []struct {
+		in, want string
+	}{
+		{"role", "role"},
+		{"private_ipv4", "private_ipv4"},
+		{"kubernetes.io/role", "kubernetes.io/role"},
+		{"_x", "_x"},
+		{"", `""`},
+		{"aws:name", `"aws:name"`},
+		{"my tag", `"my tag"`},
+		{"123", `"123"`},
+		{"1e3", `"1e3"`},
+		{"-1", `"-1"`},
+		{".inf", `".inf"`},
+		{"~", `"~"`},
+		{"null", `"null"`},
+		{"Yes", `"Yes"`},
+		{"y", `"y"`},
+		{"OFF", `"OFF"`},
+		{"false", `"false"`},
+	}
+	for _, tc := range tt {
+		if got := yamlKey(tc.in); got != tc.want {
+			t.Errorf("yamlKey(%q) = %s, want %s", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tt := []struct {
+		in, want string
+	}{
+		{"10.0.0.1", "10.0.0.1"},
+		{"fe80::1/64", "fe80::1/64"},
+		{"", "''"},
+		{"a b", "'a b'"},
+		{"$HOME", "'$HOME'"},
+		{"it's", `'it'\''s'`},
+		{"line\nbreak", "'line\nbreak'"},
+	}
+	for _, tc := range tt {
+		if got := shellQuote(tc.in); got != tc.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestStaticProvider(t *testing.T) {
+	data, err := json.Marshal(testMetadata(t))
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var m Metadata
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	provider := NewStaticProvider(&m)
+	ctx := context.Background()
+
+	if got := provider.Name(); got != "gcp" {
+		t.Errorf("Name() = %v, want gcp", got)
+	}
+	if got, err := provider.GetRegion(ctx); got != "us-central1" || err != nil {
+		t.Errorf("GetRegion() = %v, %v, want us-central1", got, err)
+	}
+	if _, err := provider.GetPublicIPv4(ctx); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetPublicIPv4() error = %v, want ErrNotFound", err)
+	}
+	if _, err := provider.GetUserData(ctx); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetUserData() error = %v, want ErrNotFound", err)
+	}
+
+	again, err := Snapshot(ctx, provider)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	compareSnapshot(t, again, &m)
+}
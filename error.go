@@ -1,8 +1,109 @@
 package cloudmeta
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
 
 var (
 	ErrUnknownProvider = errors.New("unknown cloud provider")
 	ErrNotFound        = errors.New("not found")
+	ErrUnauthorized    = errors.New("unauthorized")
+	ErrThrottled       = errors.New("throttled")
+	ErrUnavailable     = errors.New("metadata service unavailable")
+
+	// ErrNotSupported means the provider doesn't implement the optional
+	// interface needed, such as UserDataProvider
+	ErrNotSupported = errors.New("not supported by provider")
+
+	// ErrTagsDisabled means AWS instance metadata tags aren't enabled for
+	// the instance
+	ErrTagsDisabled = errors.New("instance metadata tags are disabled")
+
+	// ErrIMDSHopLimit means the AWS IMDSv2 token request timed out while
+	// IMDS answers plain requests. This happens in containers when the
+	// instance's HttpPutResponseHopLimit is too low.
+	ErrIMDSHopLimit = errors.New("IMDSv2 token request timed out but IMDS is reachable; raise the instance's HttpPutResponseHopLimit")
+
+	// ErrMalformedSSHKey means an SSH key entry served by the metadata
+	// service couldn't be parsed. See SSHKeyError.
+	ErrMalformedSSHKey = errors.New("malformed SSH key")
+
+	// ErrInvalidAddress means a metadata value isn't a valid address of
+	// the expected family. See AddrError.
+	ErrInvalidAddress = errors.New("invalid address")
 )
+
+// MetadataError describes a failed metadata request. It unwraps to one of
+// the sentinel errors above for HTTP failures, or to the transport error
+// when no response was received.
+type MetadataError struct {
+	Provider   string
+	Method     string
+	Path       string
+	StatusCode int    // zero if no response was received
+	Body       string // beginning of the response body
+	Err        error
+}
+
+func (e *MetadataError) Error() string {
+	msg := fmt.Sprintf("%s: %s %s", e.Provider, e.Method, e.Path)
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(": HTTP %d", e.StatusCode)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Body != "" {
+		msg += fmt.Sprintf(" (%q)", e.Body)
+	}
+	return msg
+}
+
+// Timeout reports whether the request failed because it timed out
+func (e *MetadataError) Timeout() bool {
+	if errors.Is(e.Err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(e.Err, &netErr) && netErr.Timeout()
+}
+
+func (e *MetadataError) Unwrap() error {
+	return e.Err
+}
+
+// statusError returns the sentinel error for an unsuccessful HTTP status,
+// or nil if there's none
+func statusError(code int) error {
+	switch {
+	case code == 404:
+		return ErrNotFound
+	case code == 401, code == 403:
+		return ErrUnauthorized
+	case code == 429:
+		return ErrThrottled
+	case code >= 500:
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// nonEmpty turns an empty metadata value into ErrNotFound
+func nonEmpty(value string, err error) (string, error) {
+	if err == nil && value == "" {
+		return "", ErrNotFound
+	}
+	return value, err
+}
+
+// optional turns ErrNotFound into an empty value, for metadata that's only
+// present on some instances
+func optional(value string, err error) (string, error) {
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	return value, err
+}
@@ -0,0 +1,82 @@
+package cloudmeta
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetadataErrorStatusMapping(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{status: http.StatusNotFound, want: ErrNotFound},
+		{status: http.StatusUnauthorized, want: ErrUnauthorized},
+		{status: http.StatusForbidden, want: ErrUnauthorized},
+		{status: http.StatusTooManyRequests, want: ErrThrottled},
+		{status: http.StatusInternalServerError, want: ErrUnavailable},
+		{status: http.StatusServiceUnavailable, want: ErrUnavailable},
+	}
+
+	for name, newProvider := range constructors {
+		for _, tt := range tests {
+			t.Run(name+"/"+http.StatusText(tt.status), func(t *testing.T) {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					// Let the AWS token request through
+					if r.Method == http.MethodPut {
+						w.Write([]byte("token"))
+						return
+					}
+					w.WriteHeader(tt.status)
+					w.Write([]byte("<html>error</html>"))
+				}))
+				defer server.Close()
+
+				provider := newProvider(WithBaseURL(server.URL), WithRetry(RetryPolicy{}))
+				_, err := provider.GetInstanceID(context.Background())
+
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("Expected %v, got %v", tt.want, err)
+				}
+
+				var mdErr *MetadataError
+				if !errors.As(err, &mdErr) {
+					t.Fatalf("Expected *MetadataError, got %T", err)
+				}
+				if mdErr.Provider != name {
+					t.Errorf("Expected provider %q, got %q", name, mdErr.Provider)
+				}
+				if mdErr.StatusCode != tt.status {
+					t.Errorf("Expected status %d, got %d", tt.status, mdErr.StatusCode)
+				}
+				if mdErr.Path == "" {
+					t.Error("Expected request path to be set")
+				}
+				if mdErr.Body != "<html>error</html>" {
+					t.Errorf("Expected body snippet, got %q", mdErr.Body)
+				}
+			})
+		}
+	}
+}
+
+func TestMetadataErrorTransport(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	_, err := NewHetznerProvider(WithBaseURL(server.URL)).GetHostname(context.Background())
+
+	var mdErr *MetadataError
+	if !errors.As(err, &mdErr) {
+		t.Fatalf("Expected *MetadataError, got %T", err)
+	}
+	if mdErr.StatusCode != 0 || mdErr.Err == nil {
+		t.Errorf("Expected transport error without status, got %+v", mdErr)
+	}
+	if mdErr.Path != "/hetzner/v1/metadata/hostname" {
+		t.Errorf("Unexpected path %q", mdErr.Path)
+	}
+}
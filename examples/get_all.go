@@ -9,7 +9,9 @@ import (
 )
 
 func main() {
-	provider, err := cloudmeta.GetProvider(context.Background())
+	ctx := context.Background()
+
+	provider, err := cloudmeta.GetProvider(ctx)
 	if err != nil {
 		if errors.Is(err, cloudmeta.ErrUnknownProvider) {
 			fmt.Println("Unknown cloud provider")
@@ -18,68 +20,35 @@ func main() {
 		panic(err)
 	}
 
-	fmt.Printf("Cloud Provider: %s\n", provider.Name())
-
-	fmt.Printf("Instance ID: ")
-	instanceID, err := provider.GetInstanceID(context.Background())
-	if err != nil {
-		if errors.Is(err, cloudmeta.ErrNotFound) {
-			fmt.Printf("none\n")
-			return
-		} else {
-			panic(err)
-		}
-	} else {
-		fmt.Printf("%s\n", instanceID)
-	}
-
-	fmt.Printf("Hostname: ")
-	hostname, err := provider.GetHostname(context.Background())
-	if err != nil {
-		if errors.Is(err, cloudmeta.ErrNotFound) {
-			fmt.Printf("none\n")
-			return
-		} else {
-			panic(err)
-		}
-	} else {
-		fmt.Printf("%s\n", hostname)
-	}
-
-	fmt.Printf("Public IPv4: ")
-	publicIPv4, err := provider.GetPublicIPv4(context.Background())
+	m, err := cloudmeta.Snapshot(ctx, provider)
 	if err != nil {
-		if errors.Is(err, cloudmeta.ErrNotFound) {
-			fmt.Printf("none\n")
-		} else {
-			panic(err)
-		}
-	} else {
-		fmt.Printf("%s\n", publicIPv4)
+		panic(err)
 	}
 
-	fmt.Printf("Private IPv4: ")
-	privateIPv4, err := provider.GetPrivateIPv4(context.Background())
-	if err != nil {
-		if errors.Is(err, cloudmeta.ErrNotFound) {
-			fmt.Printf("none\n")
-		} else {
-			panic(err)
-		}
-	} else {
-		fmt.Printf("%s\n", privateIPv4)
+	fields := []struct {
+		name  string
+		key   string
+		value string
+	}{
+		{"Instance ID", "InstanceID", m.InstanceID},
+		{"Hostname", "Hostname", m.Hostname},
+		{"Public IPv4", "PublicIPv4", m.PublicIPv4},
+		{"Private IPv4", "PrivateIPv4", m.PrivateIPv4},
+		{"Primary IPv6", "PrimaryIPv6", m.PrimaryIPv6},
+		{"Region", "Region", m.Region},
+		{"Zone", "Zone", m.Zone},
 	}
 
-	fmt.Printf("Primary IPv6: ")
-	ipv6, err := provider.GetPrimaryIPv6(context.Background())
-	if err != nil {
-		if errors.Is(err, cloudmeta.ErrNotFound) {
-			fmt.Printf("none\n")
-			return
-		} else {
-			panic(err)
+	fmt.Printf("Cloud Provider: %s\n", m.Provider)
+	for _, f := range fields {
+		err := m.Errors[f.key]
+		switch {
+		case err == nil:
+			fmt.Printf("%s: %s\n", f.name, f.value)
+		case errors.Is(err, cloudmeta.ErrNotFound):
+			fmt.Printf("%s: none\n", f.name)
+		default:
+			fmt.Printf("%s: %v\n", f.name, err)
 		}
-	} else {
-		fmt.Printf("%s\n", ipv6)
 	}
 }
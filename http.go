@@ -0,0 +1,83 @@
+package cloudmeta
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxErrorBody limits how much of an error response ends up in a MetadataError
+const maxErrorBody = 256
+
+// errNoEndpoint is returned by providers created with IPv6 pinned when the
+// platform has no IPv6 metadata endpoint
+var errNoEndpoint = fmt.Errorf("%w: no metadata service endpoint for the pinned address family", ErrUnknownProvider)
+
+// fetchBody sends req and returns the response body, retrying according to
+// retry. Failed requests and unsuccessful responses are reported as a
+// *MetadataError.
+func fetchBody(client *http.Client, retry RetryPolicy, provider, path string, req *http.Request) ([]byte, error) {
+	if req.URL.Host == "" {
+		return nil, &MetadataError{Provider: provider, Method: req.Method, Path: path, Err: errNoEndpoint}
+	}
+
+	ctx := req.Context()
+	attempts := retry.attempts(req)
+
+	for attempt := 1; ; attempt++ {
+		body, retryAfter, err := fetchOnce(client, provider, path, req.Clone(ctx))
+		if err == nil {
+			return body, nil
+		}
+
+		var mdErr *MetadataError
+		if attempt >= attempts || !errors.As(err, &mdErr) || !retryable(ctx, mdErr) {
+			return nil, err
+		}
+
+		timer := time.NewTimer(retry.delay(attempt, retryAfter))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+	}
+}
+
+// fetchOnce sends req a single time. It also returns the delay asked for by
+// a Retry-After header, if any.
+func fetchOnce(client *http.Client, provider, path string, req *http.Request) ([]byte, time.Duration, error) {
+	mdErr := &MetadataError{
+		Provider: provider,
+		Method:   req.Method,
+		Path:     path,
+	}
+
+	resp, err := doRequest(client, req)
+	if err != nil {
+		mdErr.Err = err
+		return nil, 0, mdErr
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		mdErr.StatusCode = resp.StatusCode
+		mdErr.Body = strings.TrimSpace(string(snippet))
+		mdErr.Err = statusError(resp.StatusCode)
+		return nil, parseRetryAfter(resp.Header.Get("Retry-After")), mdErr
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		mdErr.StatusCode = resp.StatusCode
+		mdErr.Err = err
+		return nil, 0, mdErr
+	}
+
+	return body, 0, nil
+}
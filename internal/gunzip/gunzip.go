@@ -0,0 +1,36 @@
+// Package gunzip decompresses the gzip payloads found in user data, for
+// both the provider getters and the userdata package.
+package gunzip
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// magic starts every gzip stream
+var magic = []byte{0x1f, 0x8b}
+
+// Is reports whether data starts with the gzip magic number
+func Is(data []byte) bool {
+	return bytes.HasPrefix(data, magic)
+}
+
+// Bytes decompresses data, failing if it expands past limit bytes
+func Bytes(data []byte, limit int) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > limit {
+		return nil, fmt.Errorf("larger than %d bytes", limit)
+	}
+	return out, nil
+}
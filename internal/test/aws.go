@@ -1,15 +1,42 @@
 package test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 )
 
+// AWSMockOptions alter the behaviour of the mock AWS metadata service
+type AWSMockOptions struct {
+	// Disabled rejects every request
+	Disabled bool
+	// DropTokenResponses never answers token requests, like IMDS behind a
+	// container network with a PUT response hop limit of 1
+	DropTokenResponses bool
+	// AllowIMDSv1 serves metadata to requests without a token
+	AllowIMDSv1 bool
+	// TagsDisabled hides instance tags, like an instance without instance
+	// metadata tags enabled
+	TagsDisabled bool
+}
+
+// AWSUserData is the user data served by the mock, gzip compressed
+const AWSUserData = "#!/bin/bash\necho hello\n"
+
 // CreateMockAWSServer creates a shared mock server for AWS metadata service
 func CreateMockAWSServer(disabled ...bool) *httptest.Server {
 	isDisabled := len(disabled) > 0 && disabled[0]
+	return CreateMockAWSServerWithOptions(AWSMockOptions{Disabled: isDisabled})
+}
+
+// CreateMockAWSServerWithOptions creates a mock server for AWS metadata service
+func CreateMockAWSServerWithOptions(opts AWSMockOptions) *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if isDisabled {
+		w.Header().Set("Server", "EC2ws")
+
+		if opts.Disabled {
 			w.WriteHeader(http.StatusForbidden)
 			w.Write([]byte("IMDSv2 disabled or blocked by security policy"))
 			return
@@ -17,6 +44,11 @@ func CreateMockAWSServer(disabled ...bool) *httptest.Server {
 
 		token := "AQAAANhJbmV0YW1ldGFkYXRhLmFtYXpvbmF3cy5jb20vMjAyMi0xMi0yMQ=="
 		if r.URL.Path == "/latest/api/token" {
+			if opts.DropTokenResponses {
+				<-r.Context().Done()
+				return
+			}
+
 			if r.Method != "PUT" {
 				w.WriteHeader(http.StatusMethodNotAllowed)
 				return
@@ -33,12 +65,54 @@ func CreateMockAWSServer(disabled ...bool) *httptest.Server {
 			return
 		}
 
-		if r.Header.Get("X-aws-ec2-metadata-token") != token {
+		got := r.Header.Get("X-aws-ec2-metadata-token")
+		if got != token && !(opts.AllowIMDSv1 && got == "") {
 			w.WriteHeader(http.StatusUnauthorized)
 			w.Write([]byte("Invalid or missing IMDSv2 token"))
 			return
 		}
 
+		tags := map[string]string{"Name": "web-1", "Environment": "production"}
+		if strings.HasPrefix(r.URL.Path, "/latest/meta-data/tags/instance/") && !opts.TagsDisabled {
+			key := strings.TrimPrefix(r.URL.Path, "/latest/meta-data/tags/instance/")
+			if key == "" {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte("Environment\nName"))
+				return
+			}
+			if value, ok := tags[key]; ok {
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(value))
+				return
+			}
+		}
+
+		// Two ENIs, the secondary one listed first
+		nics := map[string]string{
+			"network/interfaces/macs/":                                         "0e:aa:bb:cc:dd:02/\n0e:aa:bb:cc:dd:01/",
+			"network/interfaces/macs/0e:aa:bb:cc:dd:01/mac":                    "0e:aa:bb:cc:dd:01",
+			"network/interfaces/macs/0e:aa:bb:cc:dd:01/device-number":          "0",
+			"network/interfaces/macs/0e:aa:bb:cc:dd:01/interface-id":           "eni-0123456789abcdef0",
+			"network/interfaces/macs/0e:aa:bb:cc:dd:01/local-ipv4s":            "10.0.1.100\n10.0.1.101",
+			"network/interfaces/macs/0e:aa:bb:cc:dd:01/public-ipv4s":           "54.123.45.67",
+			"network/interfaces/macs/0e:aa:bb:cc:dd:01/ipv6-prefix":            "2600:1f14:abc:de00::/80",
+			"network/interfaces/macs/0e:aa:bb:cc:dd:01/ipv6s":                  "2001:db8:85a3::8a2e:370:7334",
+			"network/interfaces/macs/0e:aa:bb:cc:dd:01/subnet-ipv4-cidr-block": "10.0.1.0/24",
+			"network/interfaces/macs/0e:aa:bb:cc:dd:01/vpc-id":                 "vpc-0abc",
+			"network/interfaces/macs/0e:aa:bb:cc:dd:01/security-group-ids":     "sg-01\nsg-02",
+			"network/interfaces/macs/0e:aa:bb:cc:dd:02/mac":                    "0e:aa:bb:cc:dd:02",
+			"network/interfaces/macs/0e:aa:bb:cc:dd:02/device-number":          "1",
+			"network/interfaces/macs/0e:aa:bb:cc:dd:02/interface-id":           "eni-0fedcba9876543210",
+			"network/interfaces/macs/0e:aa:bb:cc:dd:02/local-ipv4s":            "10.0.2.50",
+			"network/interfaces/macs/0e:aa:bb:cc:dd:02/subnet-ipv4-cidr-block": "10.0.2.0/24",
+			"network/interfaces/macs/0e:aa:bb:cc:dd:02/vpc-id":                 "vpc-0abc",
+		}
+		if value, ok := nics[strings.TrimPrefix(r.URL.Path, "/latest/meta-data/")]; ok {
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(value))
+			return
+		}
+
 		switch r.URL.Path {
 		case "/latest/meta-data/instance-id":
 			w.WriteHeader(http.StatusOK)
@@ -48,6 +122,14 @@ func CreateMockAWSServer(disabled ...bool) *httptest.Server {
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte("ami-0abcdef1234567890"))
 
+		case "/latest/meta-data/instance-type":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("m5.large"))
+
+		case "/latest/dynamic/instance-identity/document":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(`{"accountId":"123456789012","instanceId":"i-1234567890abcdef0","region":"us-west-2"}`))
+
 		case "/latest/meta-data/local-ipv4":
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte("10.0.1.100"))
@@ -60,6 +142,30 @@ func CreateMockAWSServer(disabled ...bool) *httptest.Server {
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte("2001:0db8:85a3:0000:0000:8a2e:0370:7334"))
 
+		case "/latest/meta-data/placement/region":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("us-west-2"))
+
+		case "/latest/meta-data/placement/availability-zone":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("us-west-2a"))
+
+		case "/latest/meta-data/public-keys/":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("0=my-key"))
+
+		case "/latest/meta-data/public-keys/0/openssh-key":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4f\n"))
+
+		case "/latest/user-data":
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			zw.Write([]byte(AWSUserData))
+			zw.Close()
+			w.WriteHeader(http.StatusOK)
+			w.Write(buf.Bytes())
+
 		case "/latest/meta-data/hostname":
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte("ip-10-0-1-100.us-west-2.compute.internal"))
@@ -6,11 +6,44 @@ import (
 	"strings"
 )
 
+const (
+	gcpNetworkInterfaces = `[
+		{"mac":"42:01:0A:80:00:05","ip":"10.128.0.5","subnetmask":"255.255.240.0","gateway":"10.128.0.1",
+		 "network":"projects/123456789012/networks/default","ipAliases":["10.128.0.6/32","10.4.0.0/24"],
+		 "ipv6s":["2001:db8:85a3::8a2e:370:7334"],"ipv6Prefix":"2600:1900:4000:abcd:0:0::/96","accessConfigs":[{"externalIp":"34.123.45.67","type":"ONE_TO_ONE_NAT"}]},
+		{"mac":"42:01:0a:81:00:02","ip":"10.129.0.2","subnetmask":"255.255.255.0","gateway":"10.129.0.1",
+		 "network":"projects/123456789012/networks/backend","accessConfigs":[]}
+	]`
+	gcpInstanceAttributes = `{"enable-oslogin":"TRUE","role":"web","ssh-keys":"alice:ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4f alice@laptop"}`
+	gcpProjectAttributes  = `{"ssh-keys":"bob:ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAICAhIiMkJSYnKCkqKywtLi8wMTIzNDU2Nzg5Ojs8PT4/"}`
+)
+
+// gcpDocument is the recursive listing of the metadata root, matching the
+// individual entries served by the mock
+const gcpDocument = `{
+	"instance": {
+		"id": 1234567890123456789,
+		"hostname": "test-instance-1.c.my-test-project.internal",
+		"zone": "projects/123456789012/zones/us-central1-a",
+		"machineType": "projects/123456789012/machineTypes/e2-medium",
+		"image": "projects/debian-cloud/global/images/debian-12-bookworm-v20240110",
+		"attributes": ` + gcpInstanceAttributes + `,
+		"networkInterfaces": ` + gcpNetworkInterfaces + `
+	},
+	"project": {
+		"projectId": "my-test-project",
+		"numericProjectId": 123456789012,
+		"attributes": ` + gcpProjectAttributes + `
+	}
+}`
+
 // CreateMockGCPServer creates a minimal mock server for GCP metadata service
 func CreateMockGCPServer(disabled ...bool) *httptest.Server {
 	isDisabled := len(disabled) > 0 && disabled[0]
 
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Metadata-Flavor", "Google")
+
 		// Check for required Metadata-Flavor header
 		if r.Header.Get("Metadata-Flavor") != "Google" {
 			w.WriteHeader(http.StatusForbidden)
@@ -25,6 +58,10 @@ func CreateMockGCPServer(disabled ...bool) *httptest.Server {
 		}
 
 		switch r.URL.Path {
+		case "/computeMetadata/v1/":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(gcpDocument))
+
 		case "/computeMetadata/v1/instance/id":
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte("1234567890123456789"))
@@ -42,6 +79,42 @@ func CreateMockGCPServer(disabled ...bool) *httptest.Server {
 			ips := []string{"2001:db8:85a3::8a2e:370:7334", "2001:db8:85a3::8a2e:370:7335", "2001:db8:85a3::8a2e:370:7336"}
 			w.Write([]byte(strings.Join(ips, "\n")))
 
+		case "/computeMetadata/v1/instance/network-interfaces/":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(gcpNetworkInterfaces))
+
+		case "/computeMetadata/v1/instance/zone":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("projects/123456789012/zones/us-central1-a"))
+
+		case "/computeMetadata/v1/instance/machine-type":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("projects/123456789012/machineTypes/e2-medium"))
+
+		case "/computeMetadata/v1/instance/image":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("projects/debian-cloud/global/images/debian-12-bookworm-v20240110"))
+
+		case "/computeMetadata/v1/project/project-id":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("my-test-project"))
+
+		case "/computeMetadata/v1/project/numeric-project-id":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("123456789012"))
+
+		case "/computeMetadata/v1/instance/attributes/":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(gcpInstanceAttributes))
+
+		case "/computeMetadata/v1/project/attributes/":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(gcpProjectAttributes))
+
+		case "/computeMetadata/v1/instance/attributes/startup-script":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("#!/bin/sh\necho started\n"))
+
 		case "/computeMetadata/v1/instance/hostname":
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte("test-instance-1.c.my-test-project.internal"))
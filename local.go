@@ -0,0 +1,139 @@
+package cloudmeta
+
+import (
+	"context"
+	"net"
+	"slices"
+)
+
+// LinkStatus tells how a metadata NIC matched the OS network interfaces
+type LinkStatus int
+
+const (
+	// LinkMatched means exactly one OS interface has the NIC's MAC
+	LinkMatched LinkStatus = iota
+	// LinkMissing means the NIC is attached but no OS interface has its
+	// MAC, e.g. because it was hot-plugged and isn't up yet
+	LinkMissing
+	// LinkDuplicate means several OS interfaces share the MAC. Azure
+	// accelerated networking pairs each NIC with a VF this way.
+	LinkDuplicate
+	// LinkNoMAC means the metadata service doesn't report the NIC's MAC
+	LinkNoMAC
+	// LinkUnlisted means an OS interface has a MAC that no NIC in the
+	// metadata has, e.g. a bridge, a VPN tunnel or a NIC attached after
+	// the metadata was read
+	LinkUnlisted
+)
+
+func (s LinkStatus) String() string {
+	switch s {
+	case LinkMatched:
+		return "matched"
+	case LinkMissing:
+		return "missing"
+	case LinkDuplicate:
+		return "duplicate"
+	case LinkUnlisted:
+		return "unlisted"
+	}
+	return "no-mac"
+}
+
+// LocalInterface is a NIC reported by the metadata service, joined with
+// the OS interface that has its MAC. With LinkUnlisted only the OS side is
+// set and NetworkInterface is empty.
+type LocalInterface struct {
+	NetworkInterface
+
+	// Name is the OS interface name, e.g. ens5. With LinkDuplicate it's
+	// the interface with the lowest index, the others are in Aliases.
+	Name    string
+	OSIndex int
+	Aliases []string
+	Status  LinkStatus
+}
+
+// LocalInterfaces maps the NICs of the instance to OS network interfaces
+// by hardware address. NICs that can't be mapped are still returned, with
+// a Status saying why, followed by the OS interfaces with a MAC that no NIC
+// has, as LinkUnlisted. The OS interfaces come from net.Interfaces unless
+// WithInterfaceSource is given. The provider has to implement
+// NetworkInterfacesProvider.
+func LocalInterfaces(ctx context.Context, p Provider, opts ...Option) ([]LocalInterface, error) {
+	cfg := newConfig(opts...)
+
+	ext, err := extension[NetworkInterfacesProvider](p)
+	if err != nil {
+		return nil, err
+	}
+	nics, err := ext.GetNetworkInterfaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := cfg.interfaces
+	if list == nil {
+		list = net.Interfaces
+	}
+	local, err := list()
+	if err != nil {
+		return nil, err
+	}
+
+	return joinInterfaces(nics, local), nil
+}
+
+func joinInterfaces(nics []NetworkInterface, local []net.Interface) []LocalInterface {
+	byMAC := make(map[string][]net.Interface)
+	for _, iface := range local {
+		if len(iface.HardwareAddr) == 0 {
+			continue
+		}
+		mac := iface.HardwareAddr.String()
+		byMAC[mac] = append(byMAC[mac], iface)
+	}
+
+	joined := make([]LocalInterface, 0, len(nics))
+	listed := make(map[string]bool, len(nics))
+	for _, nic := range nics {
+		listed[nic.MAC] = true
+		li := LocalInterface{NetworkInterface: nic}
+
+		matches := byMAC[nic.MAC]
+		slices.SortFunc(matches, func(a, b net.Interface) int {
+			return a.Index - b.Index
+		})
+
+		switch {
+		case nic.MAC == "":
+			li.Status = LinkNoMAC
+		case len(matches) == 0:
+			li.Status = LinkMissing
+		default:
+			li.Status = LinkMatched
+			li.Name, li.OSIndex = matches[0].Name, matches[0].Index
+			if len(matches) > 1 {
+				li.Status = LinkDuplicate
+			}
+			for _, alias := range matches[1:] {
+				li.Aliases = append(li.Aliases, alias.Name)
+			}
+		}
+		joined = append(joined, li)
+	}
+
+	var unlisted []net.Interface
+	for mac, ifaces := range byMAC {
+		if !listed[mac] {
+			unlisted = append(unlisted, ifaces...)
+		}
+	}
+	slices.SortFunc(unlisted, func(a, b net.Interface) int {
+		return a.Index - b.Index
+	})
+	for _, iface := range unlisted {
+		joined = append(joined, LocalInterface{Name: iface.Name, OSIndex: iface.Index, Status: LinkUnlisted})
+	}
+	return joined
+}
@@ -0,0 +1,98 @@
+package cloudmeta
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/nickgarlis/go-cloudmeta/internal/test"
+)
+
+func mustMAC(t *testing.T, s string) net.HardwareAddr {
+	t.Helper()
+
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mac
+}
+
+func TestJoinInterfaces(t *testing.T) {
+	nics := []NetworkInterface{
+		{MAC: "00:0d:3a:f8:06:ec", DeviceIndex: 0},
+		{MAC: "00:0d:3a:f8:06:ed", DeviceIndex: 1},
+		{MAC: "00:0d:3a:f8:06:ee", DeviceIndex: 2},
+		{DeviceIndex: 3},
+	}
+	local := []net.Interface{
+		{Index: 1, Name: "lo"},
+		{Index: 4, Name: "enP1s1", HardwareAddr: mustMAC(t, "00:0d:3a:f8:06:ed")},
+		{Index: 2, Name: "eth0", HardwareAddr: mustMAC(t, "00:0d:3a:f8:06:ec")},
+		{Index: 3, Name: "eth1", HardwareAddr: mustMAC(t, "00:0d:3a:f8:06:ed")},
+		{Index: 6, Name: "wg0", HardwareAddr: mustMAC(t, "02:42:ac:11:00:03")},
+		{Index: 5, Name: "docker0", HardwareAddr: mustMAC(t, "02:42:ac:11:00:02")},
+	}
+
+	joined := joinInterfaces(nics, local)
+
+	want := []struct {
+		name    string
+		status  LinkStatus
+		aliases int
+	}{
+		{"eth0", LinkMatched, 0},
+		{"eth1", LinkDuplicate, 1},
+		{"", LinkMissing, 0},
+		{"", LinkNoMAC, 0},
+		{"docker0", LinkUnlisted, 0},
+		{"wg0", LinkUnlisted, 0},
+	}
+	if len(joined) != len(want) {
+		t.Fatalf("Expected %d interfaces, got %d", len(want), len(joined))
+	}
+	for i, w := range want {
+		got := joined[i]
+		if got.Name != w.name || got.Status != w.status || len(got.Aliases) != w.aliases {
+			t.Errorf("Interface %d: expected %s (%s, %d aliases), got %s (%s, %v)",
+				i, w.name, w.status, w.aliases, got.Name, got.Status, got.Aliases)
+		}
+		if i < len(nics) && got.DeviceIndex != nics[i].DeviceIndex {
+			t.Errorf("Interface %d: lost the metadata attributes", i)
+		}
+	}
+}
+
+func TestLocalInterfaces(t *testing.T) {
+	server := test.CreateMockAWSServer()
+	defer server.Close()
+
+	provider := NewAWSProvider(WithBaseURL(server.URL))
+	source := func() ([]net.Interface, error) {
+		return []net.Interface{
+			{Index: 2, Name: "ens5", HardwareAddr: mustMAC(t, "0e:aa:bb:cc:dd:01")},
+		}, nil
+	}
+
+	joined, err := LocalInterfaces(context.Background(), provider, WithInterfaceSource(source))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(joined) != 2 {
+		t.Fatalf("Expected 2 interfaces, got %d", len(joined))
+	}
+	if joined[0].Name != "ens5" || joined[0].OSIndex != 2 || joined[0].ID != "eni-0123456789abcdef0" {
+		t.Errorf("Expected eni-0123456789abcdef0 on ens5, got %+v", joined[0])
+	}
+	if joined[1].Status != LinkMissing {
+		t.Errorf("Expected the secondary ENI to be missing, got %s", joined[1].Status)
+	}
+
+	failing := func() ([]net.Interface, error) {
+		return nil, errors.New("netlink unavailable")
+	}
+	if _, err := LocalInterfaces(context.Background(), provider, WithInterfaceSource(failing)); err == nil {
+		t.Error("Expected the interface source error")
+	}
+}
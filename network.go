@@ -0,0 +1,135 @@
+package cloudmeta
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// NetworkInterface describes a NIC attached to the instance. Fields the
+// provider doesn't expose are left empty.
+type NetworkInterface struct {
+	// ID is the provider's identifier for the interface, e.g. an AWS ENI
+	// ID or an OCI VNIC OCID
+	ID string `json:"id,omitempty"`
+	// MAC is the hardware address in lower case, colon separated form
+	MAC string `json:"mac,omitempty"`
+	// DeviceIndex is the position of the interface on the instance,
+	// starting at 0 for the primary interface
+	DeviceIndex  int      `json:"device_index"`
+	PrivateIPv4s []string `json:"private_ipv4s,omitempty"`
+	PublicIPv4s  []string `json:"public_ipv4s,omitempty"`
+	IPv6s        []string `json:"ipv6s,omitempty"`
+	// IPv6Prefixes are the prefixes delegated to the interface
+	IPv6Prefixes []string `json:"ipv6_prefixes,omitempty"`
+	// SubnetCIDR is the IPv4 range of the subnet, e.g. 10.0.1.0/24
+	SubnetCIDR string `json:"subnet_cidr,omitempty"`
+	Gateway    string `json:"gateway,omitempty"`
+	// NetworkID is the VPC, VNet or network the interface belongs to
+	NetworkID      string   `json:"network_id,omitempty"`
+	SecurityGroups []string `json:"security_groups,omitempty"`
+}
+
+// normalizeMAC formats a hardware address as lower case colon separated
+// hex. Addresses without separators, as Azure reports them, are accepted.
+func normalizeMAC(mac string) string {
+	mac = strings.ToLower(strings.TrimSpace(mac))
+	if len(mac) == 12 && !strings.ContainsAny(mac, ":-") {
+		parts := make([]string, 0, 6)
+		for i := 0; i < 12; i += 2 {
+			parts = append(parts, mac[i:i+2])
+		}
+		return strings.Join(parts, ":")
+	}
+
+	if hw, err := net.ParseMAC(mac); err == nil {
+		return hw.String()
+	}
+	return mac
+}
+
+// subnetCIDR returns the network containing ip, given a netmask in dotted
+// form or as a prefix length. It returns an empty string if either can't
+// be parsed.
+func subnetCIDR(ip, mask string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+
+	bits, err := strconv.Atoi(mask)
+	if err != nil {
+		m, err := netip.ParseAddr(mask)
+		if err != nil {
+			return ""
+		}
+		ones, size := net.IPMask(m.AsSlice()).Size()
+		if size == 0 {
+			return ""
+		}
+		bits = ones
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.String()
+}
+
+// splitLines splits a newline separated metadata listing, dropping empty
+// lines
+func splitLines(s string) []string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// appendNonEmpty appends the values that aren't empty
+func appendNonEmpty(list []string, values ...string) []string {
+	for _, v := range values {
+		if v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// ipv6Addresses returns the IPv6 addresses of every interface, or
+// ErrNotFound if there are none
+func ipv6Addresses(ctx context.Context, p NetworkInterfacesProvider) ([]string, error) {
+	return fromInterfaces(ctx, p, func(nic NetworkInterface) []string { return nic.IPv6s })
+}
+
+// ipv6Prefixes returns the IPv6 prefixes delegated to every interface, or
+// ErrNotFound if there are none
+func ipv6Prefixes(ctx context.Context, p NetworkInterfacesProvider) ([]string, error) {
+	return fromInterfaces(ctx, p, func(nic NetworkInterface) []string { return nic.IPv6Prefixes })
+}
+
+func fromInterfaces(ctx context.Context, p NetworkInterfacesProvider, field func(NetworkInterface) []string) ([]string, error) {
+	nics, err := p.GetNetworkInterfaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return interfaceValues(nics, field)
+}
+
+// interfaceValues collects a field of every interface, or returns
+// ErrNotFound if there are no values
+func interfaceValues(nics []NetworkInterface, field func(NetworkInterface) []string) ([]string, error) {
+	var values []string
+	for _, nic := range nics {
+		values = append(values, field(nic)...)
+	}
+	if len(values) == 0 {
+		return nil, ErrNotFound
+	}
+	return values, nil
+}
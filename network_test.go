@@ -0,0 +1,87 @@
+package cloudmeta
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeMAC(t *testing.T) {
+	tests := map[string]string{
+		"000D3AF806EC":      "00:0d:3a:f8:06:ec",
+		"0E:49:61:0F:C3:11": "0e:49:61:0f:c3:11",
+		"fa-16-3e-00-00-01": "fa:16:3e:00:00:01",
+		"":                  "",
+	}
+
+	for in, want := range tests {
+		if got := normalizeMAC(in); got != want {
+			t.Errorf("normalizeMAC(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSubnetCIDR(t *testing.T) {
+	tests := []struct {
+		ip, mask, want string
+	}{
+		{"10.128.0.5", "255.255.240.0", "10.128.0.0/20"},
+		{"10.0.0.4", "24", "10.0.0.0/24"},
+		{"2001:db8::5", "ffff:ffff:ffff:ffff::", "2001:db8::/64"},
+		{"10.0.0.4", "255.0.255.0", ""},
+		{"not-an-ip", "24", ""},
+		{"10.0.0.4", "33", ""},
+	}
+
+	for _, tt := range tests {
+		if got := subnetCIDR(tt.ip, tt.mask); got != tt.want {
+			t.Errorf("subnetCIDR(%q, %q) = %q, want %q", tt.ip, tt.mask, got, tt.want)
+		}
+	}
+}
+
+func TestParseHetznerNetworks(t *testing.T) {
+	text := `- ip: 10.0.0.2
+  alias_ips: [10.0.0.3, "10.0.0.4"]
+  interface_num: 1
+  mac_address: 86:00:00:2a:7d:e0
+  network_id: 1234
+  subnet: 10.0.0.0/24
+  gateway: 10.0.0.1
+- ip: 10.1.0.2
+  alias_ips:
+  - 10.1.0.3
+  interface_num: 2
+`
+
+	networks, err := parseHetznerNetworks(text)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []hetznerNetwork{
+		{
+			"ip":            {"10.0.0.2"},
+			"alias_ips":     {"10.0.0.3", "10.0.0.4"},
+			"interface_num": {"1"},
+			"mac_address":   {"86:00:00:2a:7d:e0"},
+			"network_id":    {"1234"},
+			"subnet":        {"10.0.0.0/24"},
+			"gateway":       {"10.0.0.1"},
+		},
+		{
+			"ip":            {"10.1.0.2"},
+			"alias_ips":     {"10.1.0.3"},
+			"interface_num": {"2"},
+		},
+	}
+	if !reflect.DeepEqual(networks, want) {
+		t.Errorf("Expected %v, got %v", want, networks)
+	}
+
+	if networks, err := parseHetznerNetworks("[]\n"); err != nil || len(networks) != 0 {
+		t.Errorf("Expected no networks, got %v, %v", networks, err)
+	}
+	if _, err := parseHetznerNetworks("ip: 10.0.0.2\n"); err == nil {
+		t.Error("Expected error for a mapping outside a sequence")
+	}
+}
@@ -0,0 +1,314 @@
+package cloudmeta
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout         = 2 * time.Second
+	defaultDialTimeout     = 1 * time.Second
+	defaultProbeTimeout    = 2 * time.Second
+	defaultAWSTokenTTL     = maxAWSTokenTTL
+	minAWSTokenTTL         = time.Second
+	maxAWSTokenTTL         = 6 * time.Hour
+	defaultAzureAPIVersion = "2025-04-07"
+)
+
+// Environment variables that override the defaults of every Detector and
+// provider. Options take precedence over them.
+const (
+	// EnvProvider forces the detected provider by name. The value "none"
+	// makes detection fail with ErrUnknownProvider without any probing.
+	EnvProvider = "CLOUDMETA_PROVIDER"
+	// EnvEndpoint overrides the metadata service URL of every provider
+	EnvEndpoint = "CLOUDMETA_ENDPOINT"
+)
+
+// defaultTransport is shared by all providers that aren't given a custom
+// client or transport. Metadata services are link-local, so it never uses
+// a proxy.
+var defaultTransport = &http.Transport{
+	DialContext: (&net.Dialer{
+		Timeout: defaultDialTimeout,
+	}).DialContext,
+}
+
+// AddressFamily selects which metadata service endpoints are used
+type AddressFamily int
+
+const (
+	// AddressFamilyAny tries the IPv4 endpoint first and then the IPv6 one
+	// during detection. Providers created directly use IPv4.
+	AddressFamilyAny AddressFamily = iota
+	// AddressFamilyIPv4 only uses IPv4 endpoints
+	AddressFamilyIPv4
+	// AddressFamilyIPv6 only uses IPv6 endpoints. Providers without one
+	// are skipped during detection, and their requests fail with
+	// ErrUnknownProvider when they're created directly.
+	AddressFamilyIPv6
+)
+
+// CachePolicy controls which detection results a Detector remembers
+type CachePolicy int
+
+const (
+	// CacheSuccess caches a detected provider and retries detection after
+	// any error. This is the default.
+	CacheSuccess CachePolicy = iota
+	// CacheAll caches the first result, including errors
+	CacheAll
+	// CacheNone runs detection on every call
+	CacheNone
+)
+
+// config holds the settings applied through Options
+type config struct {
+	baseURL       string
+	client        *http.Client
+	transport     http.RoundTripper
+	timeout       time.Duration
+	probeTimeout  time.Duration
+	detectTimeout time.Duration
+	allow         []string
+	deny          []string
+	cachePolicy   CachePolicy
+	dmiRoot       string
+	forced        string
+	family        AddressFamily
+	retry         RetryPolicy
+	rawUserData   bool
+	interfaces    func() ([]net.Interface, error)
+
+	// Provider specific settings
+	awsTokenTTL     time.Duration
+	awsIMDSv1       bool
+	azureAPIVersion string
+}
+
+// Option configures a Detector or a provider. Options that don't apply to
+// the value being configured are ignored.
+type Option func(*config)
+
+func newConfig(opts ...Option) *config {
+	cfg := &config{
+		timeout:       defaultTimeout,
+		probeTimeout:  defaultProbeTimeout,
+		detectTimeout: defaultDetectTimeout,
+		cachePolicy:   CacheSuccess,
+		dmiRoot:       defaultDMIRoot,
+		retry:         DefaultRetryPolicy,
+
+		awsTokenTTL:     defaultAWSTokenTTL,
+		azureAPIVersion: defaultAzureAPIVersion,
+
+		baseURL: os.Getenv(EnvEndpoint),
+		forced:  os.Getenv(EnvProvider),
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithBaseURL overrides the metadata service URL of every provider
+func WithBaseURL(url string) Option {
+	return func(c *config) {
+		c.baseURL = url
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to reach the metadata service.
+// It takes precedence over WithTransport.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config) {
+		c.client = client
+	}
+}
+
+// WithTransport sets the RoundTripper used by the default HTTP client
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *config) {
+		c.transport = rt
+	}
+}
+
+// WithTimeout sets the timeout of each metadata request made by the default
+// HTTP client. It has no effect when WithHTTPClient is used.
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.timeout = d
+	}
+}
+
+// WithProbeTimeout limits how long a single provider may take to answer
+// during detection. Zero disables the limit.
+func WithProbeTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.probeTimeout = d
+	}
+}
+
+// WithDetectTimeout limits the total time spent detecting the provider.
+// Zero disables the limit, leaving only the caller's context deadline.
+func WithDetectTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.detectTimeout = d
+	}
+}
+
+// WithProviders restricts detection to the named providers
+func WithProviders(names ...string) Option {
+	return func(c *config) {
+		c.allow = append(c.allow, names...)
+	}
+}
+
+// WithoutProviders excludes the named providers from detection
+func WithoutProviders(names ...string) Option {
+	return func(c *config) {
+		c.deny = append(c.deny, names...)
+	}
+}
+
+// WithCachePolicy sets which detection results are cached
+func WithCachePolicy(policy CachePolicy) Option {
+	return func(c *config) {
+		c.cachePolicy = policy
+	}
+}
+
+// WithDMIRoot sets the sysfs directory SMBIOS/DMI fields are read from.
+// An empty path disables DMI based detection.
+func WithDMIRoot(path string) Option {
+	return func(c *config) {
+		c.dmiRoot = path
+	}
+}
+
+// WithAddressFamily pins the address family of the metadata service
+// endpoints. It has no effect when a base URL is set.
+func WithAddressFamily(family AddressFamily) Option {
+	return func(c *config) {
+		c.family = family
+	}
+}
+
+// WithForcedProvider makes detection return the named provider without
+// probing the network. The name "none" makes detection fail with
+// ErrUnknownProvider, and an empty name restores normal detection.
+func WithForcedProvider(name string) Option {
+	return func(c *config) {
+		c.forced = name
+	}
+}
+
+// WithRawUserData makes GetUserData return user data as served by the
+// metadata service, without base64 or gzip decoding
+func WithRawUserData() Option {
+	return func(c *config) {
+		c.rawUserData = true
+	}
+}
+
+// WithInterfaceSource replaces net.Interfaces as the source of OS network
+// interfaces for LocalInterfaces
+func WithInterfaceSource(list func() ([]net.Interface, error)) Option {
+	return func(c *config) {
+		c.interfaces = list
+	}
+}
+
+// WithAWSTokenTTL sets the lifetime requested for AWS IMDSv2 session tokens.
+// AWS accepts values between one second and six hours; others are clamped
+// to that range.
+func WithAWSTokenTTL(d time.Duration) Option {
+	return func(c *config) {
+		c.awsTokenTTL = min(max(d, minAWSTokenTTL), maxAWSTokenTTL)
+	}
+}
+
+// WithAWSIMDSv1Fallback lets AWS fall back to IMDSv1 requests without a
+// session token when no IMDSv2 token can be obtained
+func WithAWSIMDSv1Fallback() Option {
+	return func(c *config) {
+		c.awsIMDSv1 = true
+	}
+}
+
+// WithAzureAPIVersion sets the api-version used for Azure IMDS requests
+func WithAzureAPIVersion(version string) Option {
+	return func(c *config) {
+		c.azureAPIVersion = version
+	}
+}
+
+// endpoints returns the metadata service URLs to try, in order. ipv6 is
+// empty for providers without an IPv6 endpoint.
+func (c *config) endpoints(ipv4, ipv6 string) []string {
+	if c.baseURL != "" {
+		return []string{strings.TrimSuffix(c.baseURL, "/")}
+	}
+
+	switch {
+	case c.family == AddressFamilyIPv4 || ipv6 == "" && c.family == AddressFamilyAny:
+		return []string{ipv4}
+	case ipv6 == "":
+		return nil
+	case c.family == AddressFamilyIPv6:
+		return []string{ipv6}
+	}
+	return []string{ipv4, ipv6}
+}
+
+// url returns the metadata service URL a provider is created with. It's
+// ipv4 unless a base URL is configured or IPv6 is pinned. It's empty when
+// IPv6 is pinned and the provider has no IPv6 endpoint; requests then fail
+// with ErrUnknownProvider.
+func (c *config) url(ipv4, ipv6 string) string {
+	if endpoints := c.endpoints(ipv4, ipv6); len(endpoints) > 0 {
+		return endpoints[0]
+	}
+	return ""
+}
+
+// endpointOptions returns opts once for every endpoint detection should
+// try, each time with the base URL set to that endpoint
+func endpointOptions(opts []Option, ipv4, ipv6 string) [][]Option {
+	endpoints := newConfig(opts...).endpoints(ipv4, ipv6)
+
+	list := make([][]Option, len(endpoints))
+	for i, url := range endpoints {
+		list[i] = append(slices.Clip(opts), WithBaseURL(url))
+	}
+	return list
+}
+
+// httpClient returns the configured HTTP client, or a default one
+func (c *config) httpClient() *http.Client {
+	if c.client != nil {
+		return c.client
+	}
+
+	transport := c.transport
+	if transport == nil {
+		transport = defaultTransport
+	}
+
+	return &http.Client{
+		Timeout:   c.timeout,
+		Transport: transport,
+	}
+}
+
+// enabled reports whether the named provider takes part in detection
+func (c *config) enabled(name string) bool {
+	if slices.Contains(c.deny, name) {
+		return false
+	}
+	return len(c.allow) == 0 || slices.Contains(c.allow, name)
+}
@@ -0,0 +1,97 @@
+package cloudmeta
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestConfigEndpoints(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		ipv6 string
+		want []string
+	}{
+		{
+			name: "any family",
+			ipv6: awsMetadataIPv6URL,
+			want: []string{awsMetadataURL, awsMetadataIPv6URL},
+		},
+		{
+			name: "any family without ipv6 endpoint",
+			want: []string{awsMetadataURL},
+		},
+		{
+			name: "pinned ipv4",
+			opts: []Option{WithAddressFamily(AddressFamilyIPv4)},
+			ipv6: awsMetadataIPv6URL,
+			want: []string{awsMetadataURL},
+		},
+		{
+			name: "pinned ipv6",
+			opts: []Option{WithAddressFamily(AddressFamilyIPv6)},
+			ipv6: awsMetadataIPv6URL,
+			want: []string{awsMetadataIPv6URL},
+		},
+		{
+			name: "pinned ipv6 without ipv6 endpoint",
+			opts: []Option{WithAddressFamily(AddressFamilyIPv6)},
+			want: nil,
+		},
+		{
+			name: "base url",
+			opts: []Option{WithBaseURL("http://127.0.0.1:1338/"), WithAddressFamily(AddressFamilyIPv6)},
+			ipv6: awsMetadataIPv6URL,
+			want: []string{"http://127.0.0.1:1338"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := newConfig(tt.opts...).endpoints(awsMetadataURL, tt.ipv6)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("endpoints() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewProviderAddressFamily(t *testing.T) {
+	if got := NewAWSProvider(WithAddressFamily(AddressFamilyIPv6)).baseURL; got != awsMetadataIPv6URL {
+		t.Errorf("Expected AWS to use %s, got %s", awsMetadataIPv6URL, got)
+	}
+	if got := NewOCIProvider(WithAddressFamily(AddressFamilyIPv6)).baseURL; got != ociMetadataIPv6URL {
+		t.Errorf("Expected OCI to use %s, got %s", ociMetadataIPv6URL, got)
+	}
+	if got := NewAWSProvider().baseURL; got != awsMetadataURL {
+		t.Errorf("Expected AWS to default to %s, got %s", awsMetadataURL, got)
+	}
+
+	// Azure has no IPv6 endpoint
+	_, err := NewAzureProvider(WithAddressFamily(AddressFamilyIPv6)).GetInstanceID(context.Background())
+	if !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("Expected ErrUnknownProvider for Azure pinned to IPv6, got %v", err)
+	}
+}
+
+func TestWithAWSTokenTTL(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want time.Duration
+	}{
+		{time.Hour, time.Hour},
+		{0, time.Second},
+		{-time.Minute, time.Second},
+		{time.Millisecond, time.Second},
+		{24 * time.Hour, 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := NewAWSProvider(WithAWSTokenTTL(tt.ttl)).tokenTTL; got != tt.want {
+			t.Errorf("WithAWSTokenTTL(%v) = %v, want %v", tt.ttl, got, tt.want)
+		}
+	}
+}
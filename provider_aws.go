@@ -1,117 +1,234 @@
 package cloudmeta
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
-const awsMetadataURL = "http://169.254.169.254"
+const (
+	awsMetadataURL     = "http://169.254.169.254"
+	awsMetadataIPv6URL = "http://[fd00:ec2::254]"
+)
+
+// awsTokenRefresh is the longest time before expiry at which a cached
+// IMDSv2 token is replaced
+const awsTokenRefresh = time.Minute
 
 type AWSProvider struct {
-	baseURL string
-	client  *http.Client
+	baseURL  string
+	client   *http.Client
+	tokenTTL time.Duration
+	// tokenTimeout bounds the token request to half the request timeout,
+	// leaving time to find out whether plain requests get through when it
+	// times out
+	tokenTimeout time.Duration
+	retry        RetryPolicy
+	rawUserData  bool
+	fallback     bool
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+	imdsv1      bool // IMDSv2 failed and requests are sent without a token
 }
 
 func (p *AWSProvider) Name() string {
 	return "aws"
 }
 
-func newAWSProvider(baseURL ...string) *AWSProvider {
-	url := awsMetadataURL
-	if len(baseURL) > 0 && baseURL[0] != "" {
-		url = strings.TrimSuffix(baseURL[0], "/")
-	}
-	client := &http.Client{
-		Timeout: 2 * time.Second,
-		Transport: &http.Transport{
-			DialContext: (&net.Dialer{
-				Timeout: 1 * time.Second,
-			}).DialContext,
-		},
+// NewAWSProvider creates a provider for the AWS EC2 instance metadata service (IMDSv2)
+func NewAWSProvider(opts ...Option) *AWSProvider {
+	cfg := newConfig(opts...)
+
+	client := cfg.httpClient()
+	timeout := client.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
 	}
 
-	return &AWSProvider{client: client, baseURL: url}
+	return &AWSProvider{
+		client:       client,
+		retry:        cfg.retry,
+		rawUserData:  cfg.rawUserData,
+		baseURL:      cfg.url(awsMetadataURL, awsMetadataIPv6URL),
+		tokenTTL:     cfg.awsTokenTTL,
+		tokenTimeout: timeout / 2,
+		fallback:     cfg.awsIMDSv1,
+	}
 }
 
-func detectAWS(ctx context.Context, baseURL ...string) Provider {
-	provider := newAWSProvider(baseURL...)
+func detectAWS(ctx context.Context, opts ...Option) (Provider, error) {
+	for _, opts := range endpointOptions(opts, awsMetadataURL, awsMetadataIPv6URL) {
+		provider := NewAWSProvider(opts...)
 
-	token, err := provider.GetIMDSv2Token(ctx)
-	if err == nil && token != "" {
-		return provider
+		token, err := provider.sessionToken(ctx)
+		switch {
+		case errors.Is(err, ErrIMDSHopLimit):
+			// Running on AWS, but unable to read metadata
+			return nil, err
+		case err != nil:
+			continue
+		case token == "":
+			recordSignal(ctx, "imdsv1")
+		default:
+			recordSignal(ctx, "imdsv2-token")
+		}
+
+		return provider, nil
 	}
 
-	return nil
+	return nil, nil
 }
 
-// GetIMDSv2Token gets an IMDSv2 token for secure metadata access
+// GetIMDSv2Token gets a new IMDSv2 token for secure metadata access.
+// Metadata reads don't need it; they use a cached session token.
 func (p *AWSProvider) GetIMDSv2Token(ctx context.Context) (string, error) {
 	req, err := http.NewRequestWithContext(ctx, "PUT", p.baseURL+"/latest/api/token", nil)
 	if err != nil {
 		return "", err
 	}
 
-	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	ttl := int(p.tokenTTL / time.Second)
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", strconv.Itoa(ttl))
 
-	resp, err := p.client.Do(req)
+	body, err := fetchBody(p.client, p.retry, p.Name(), "/latest/api/token", req)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to get IMDSv2 token: HTTP %d", resp.StatusCode)
+	return string(body), nil
+}
+
+// sessionToken returns the cached IMDSv2 token, requesting a new one when
+// there's none or it's about to expire. Concurrent callers share a single
+// token request. It returns an empty token once the provider fell back to
+// IMDSv1.
+func (p *AWSProvider) sessionToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.imdsv1 {
+		return "", nil
+	}
+
+	refresh := min(awsTokenRefresh, p.tokenTTL/10)
+	if p.token != "" && time.Now().Before(p.tokenExpiry.Add(-refresh)) {
+		return p.token, nil
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	// Expiry is counted from before the request so it's never overestimated
+	start := time.Now()
+	tokenCtx, cancel := context.WithTimeout(ctx, p.tokenTimeout)
+	token, err := p.GetIMDSv2Token(tokenCtx)
+	cancel()
 	if err != nil {
-		return "", err
+		return "", p.tokenFailure(ctx, err)
 	}
 
-	return string(body), nil
+	p.token = token
+	p.tokenExpiry = start.Add(p.tokenTTL)
+	return token, nil
 }
 
-// fetchMetadata makes HTTP requests to AWS metadata service
-func (p *AWSProvider) fetchMetadata(ctx context.Context, path string) (string, error) {
-	url := p.baseURL + path
+// tokenFailure checks whether IMDS answers requests without a token after
+// the token request failed with err. If it serves them, the provider falls
+// back to IMDSv1 when allowed. Otherwise, when the token request timed out
+// and EC2 answered, whether with the metadata or with the HTTP 401 of an
+// instance that requires IMDSv2, it reports ErrIMDSHopLimit. Answers from
+// other servers don't count, so that other metadata services at the same
+// address aren't mistaken for IMDS. The caller must hold p.mu.
+func (p *AWSProvider) tokenFailure(ctx context.Context, err error) error {
+	var mdErr *MetadataError
+	timeout := errors.As(err, &mdErr) && mdErr.Timeout()
+	if !timeout && !p.fallback {
+		return err
+	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return "", err
+	req, reqErr := http.NewRequestWithContext(ctx, "GET", p.baseURL+"/latest/meta-data/instance-id", nil)
+	if reqErr != nil {
+		return err
+	}
+	resp, reqErr := doRequest(p.client, req)
+	if reqErr != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	ok := resp.StatusCode == http.StatusOK
+	switch {
+	case ok && p.fallback:
+		p.imdsv1 = true
+		return nil
+	case (ok || resp.StatusCode == http.StatusUnauthorized) && timeout && resp.Header.Get("Server") == "EC2ws":
+		return fmt.Errorf("%w: %w", ErrIMDSHopLimit, err)
+	}
+	return err
+}
+
+// invalidateToken drops the cached token unless it was already replaced
+func (p *AWSProvider) invalidateToken(token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token == token {
+		p.token = ""
 	}
+}
 
-	token, err := p.GetIMDSv2Token(ctx)
+// fetchMetadata makes HTTP requests to AWS metadata service
+func (p *AWSProvider) fetchMetadata(ctx context.Context, path string) (string, error) {
+	body, err := p.fetchRaw(ctx, path)
 	if err != nil {
 		return "", err
 	}
-	req.Header.Set("X-aws-ec2-metadata-token", token)
 
-	resp, err := p.client.Do(req)
+	return strings.TrimSpace(string(body)), nil
+}
+
+// fetchRaw reads path without trimming the response. A token rejected
+// with HTTP 401 is replaced and the request is sent once more; IMDSv1
+// requests, which carry no token, aren't retried.
+func (p *AWSProvider) fetchRaw(ctx context.Context, path string) ([]byte, error) {
+	token, err := p.sessionToken(ctx)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	switch resp.StatusCode {
-	case http.StatusNotFound:
-		return "", ErrNotFound
-	case http.StatusOK:
-		// continue
-	default:
-		return "", fmt.Errorf("HTTP %d for %s", resp.StatusCode, path)
+	body, err := p.get(ctx, path, token)
+
+	var mdErr *MetadataError
+	if token != "" && errors.As(err, &mdErr) && mdErr.StatusCode == http.StatusUnauthorized {
+		p.invalidateToken(token)
+		if token, err = p.sessionToken(ctx); err != nil {
+			return nil, err
+		}
+		body, err = p.get(ctx, path, token)
 	}
+	return body, err
+}
 
-	body, err := io.ReadAll(resp.Body)
+// get reads path with the given session token, or as an IMDSv1 request if
+// the token is empty
+func (p *AWSProvider) get(ctx context.Context, path, token string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+path, nil)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-aws-ec2-metadata-token", token)
 	}
 
-	return strings.TrimSpace(string(body)), nil
+	return fetchBody(p.client, p.retry, p.Name(), path, req)
 }
 
 func (p *AWSProvider) GetInstanceID(ctx context.Context) (string, error) {
@@ -137,3 +254,180 @@ func (p *AWSProvider) GetHostname(ctx context.Context) (string, error) {
 func (p *AWSProvider) GetPrimaryIPv6(ctx context.Context) (string, error) {
 	return p.fetchMetadata(ctx, "/latest/meta-data/ipv6")
 }
+
+// GetRegion returns the AWS region
+func (p *AWSProvider) GetRegion(ctx context.Context) (string, error) {
+	return p.fetchMetadata(ctx, "/latest/meta-data/placement/region")
+}
+
+// GetZone returns the availability zone
+func (p *AWSProvider) GetZone(ctx context.Context) (string, error) {
+	return p.fetchMetadata(ctx, "/latest/meta-data/placement/availability-zone")
+}
+
+// GetInstanceType returns the instance type, e.g. m5.large
+func (p *AWSProvider) GetInstanceType(ctx context.Context) (string, error) {
+	return p.fetchMetadata(ctx, "/latest/meta-data/instance-type")
+}
+
+// GetImageID returns the AMI ID the instance was launched from
+func (p *AWSProvider) GetImageID(ctx context.Context) (string, error) {
+	return p.fetchMetadata(ctx, "/latest/meta-data/ami-id")
+}
+
+// GetAccount returns the AWS account ID from the instance identity document
+func (p *AWSProvider) GetAccount(ctx context.Context) (*Account, error) {
+	const path = "/latest/dynamic/instance-identity/document"
+	doc, err := p.fetchMetadata(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var identity struct {
+		AccountID string `json:"accountId"`
+	}
+	if err := json.Unmarshal([]byte(doc), &identity); err != nil {
+		return nil, fmt.Errorf("aws: decoding %s: %w", path, err)
+	}
+	if identity.AccountID == "" {
+		return nil, ErrNotFound
+	}
+
+	return &Account{ID: identity.AccountID}, nil
+}
+
+// GetTags returns the instance tags. They're only available when instance
+// metadata tags are enabled, otherwise ErrTagsDisabled is returned.
+func (p *AWSProvider) GetTags(ctx context.Context) (map[string]string, error) {
+	const path = "/latest/meta-data/tags/instance/"
+	keys, err := p.fetchMetadata(ctx, path)
+	if errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("%w: %w", ErrTagsDisabled, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make(map[string]string)
+	for _, key := range strings.Split(keys, "\n") {
+		if key == "" {
+			continue
+		}
+		value, err := p.fetchMetadata(ctx, path+url.PathEscape(key))
+		if err != nil {
+			return nil, err
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+// GetUserData returns the user data the instance was launched with
+func (p *AWSProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	data, err := p.fetchRaw(ctx, "/latest/user-data")
+	if err != nil {
+		return nil, err
+	}
+	return decodeUserData(data, false, p.rawUserData)
+}
+
+// GetSSHKeys returns the keys of the key pairs the instance was launched
+// with. Keys without a comment are labelled with the key pair name.
+func (p *AWSProvider) GetSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	// Listed as <index>=<key pair name>
+	list, err := p.fetchMetadata(ctx, "/latest/meta-data/public-keys/")
+	if err != nil {
+		return nil, err
+	}
+
+	var keys sshKeys
+	for _, line := range splitLines(list) {
+		index, name, ok := strings.Cut(line, "=")
+		if !ok {
+			keys.fail(line, "missing key pair index")
+			continue
+		}
+		key, err := p.fetchMetadata(ctx, "/latest/meta-data/public-keys/"+index+"/openssh-key")
+		if err != nil {
+			return nil, err
+		}
+		keys.add(key, "", name)
+	}
+	return keys.result()
+}
+
+// GetNetworkInterfaces returns the ENIs attached to the instance, ordered
+// by device number
+func (p *AWSProvider) GetNetworkInterfaces(ctx context.Context) ([]NetworkInterface, error) {
+	const macs = "/latest/meta-data/network/interfaces/macs/"
+	list, err := p.fetchMetadata(ctx, macs)
+	if err != nil {
+		return nil, err
+	}
+
+	var nics []NetworkInterface
+	// Listed as <mac>/
+	for _, mac := range splitLines(list) {
+		nic, err := p.networkInterface(ctx, macs+strings.TrimSuffix(mac, "/")+"/")
+		if err != nil {
+			return nil, err
+		}
+		nics = append(nics, *nic)
+	}
+
+	slices.SortStableFunc(nics, func(a, b NetworkInterface) int {
+		return cmp.Compare(a.DeviceIndex, b.DeviceIndex)
+	})
+	return nics, nil
+}
+
+// networkInterface reads the ENI at dir, .../macs/<mac>/
+func (p *AWSProvider) networkInterface(ctx context.Context, dir string) (*NetworkInterface, error) {
+	fields := []string{
+		"mac", "device-number", "interface-id", "local-ipv4s", "public-ipv4s",
+		"ipv6s", "ipv6-prefix", "subnet-ipv4-cidr-block", "vpc-id", "security-group-ids",
+	}
+
+	values := make(map[string]string, len(fields))
+	for _, key := range fields {
+		// Missing keys are normal: public IPs, IPv6, prefixes and security
+		// groups are only listed when the ENI has them
+		value, err := optional(p.fetchMetadata(ctx, dir+key))
+		if err != nil {
+			return nil, err
+		}
+		values[key] = value
+	}
+
+	index, err := strconv.Atoi(values["device-number"])
+	if err != nil {
+		return nil, fmt.Errorf("aws: parsing %sdevice-number: %w", dir, err)
+	}
+
+	return &NetworkInterface{
+		ID:             values["interface-id"],
+		MAC:            normalizeMAC(values["mac"]),
+		DeviceIndex:    index,
+		PrivateIPv4s:   splitLines(values["local-ipv4s"]),
+		PublicIPv4s:    splitLines(values["public-ipv4s"]),
+		IPv6s:          splitLines(values["ipv6s"]),
+		IPv6Prefixes:   splitLines(values["ipv6-prefix"]),
+		SubnetCIDR:     values["subnet-ipv4-cidr-block"],
+		NetworkID:      values["vpc-id"],
+		SecurityGroups: splitLines(values["security-group-ids"]),
+	}, nil
+}
+
+// GetIPv6Addresses returns the IPv6 addresses of every ENI
+func (p *AWSProvider) GetIPv6Addresses(ctx context.Context) ([]string, error) {
+	return ipv6Addresses(ctx, p)
+}
+
+// GetIPv6Prefixes returns the IPv6 prefixes delegated to every ENI
+func (p *AWSProvider) GetIPv6Prefixes(ctx context.Context) ([]string, error) {
+	return ipv6Prefixes(ctx, p)
+}
+
+func (p *AWSProvider) ipv6PrefixesFromInterfaces() bool {
+	return true
+}
@@ -2,8 +2,16 @@ package cloudmeta
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/nickgarlis/go-cloudmeta/internal/gunzip"
 	"github.com/nickgarlis/go-cloudmeta/internal/test"
 )
 
@@ -42,7 +50,7 @@ func TestAWSProvider_GetIMDSv2Token(t *testing.T) {
 			server := test.CreateMockAWSServer(tt.responseCode == 403)
 			defer server.Close()
 
-			provider := newAWSProvider(server.URL)
+			provider := NewAWSProvider(WithBaseURL(server.URL))
 			ctx := context.Background()
 
 			token, err := provider.GetIMDSv2Token(ctx)
@@ -67,7 +75,7 @@ func TestAWSProvider_TestGetPrivateIPv4(t *testing.T) {
 	server := test.CreateMockAWSServer()
 	defer server.Close()
 
-	provider := newAWSProvider(server.URL)
+	provider := NewAWSProvider(WithBaseURL(server.URL))
 	ctx := context.Background()
 
 	ip, err := provider.GetPrivateIPv4(ctx)
@@ -84,7 +92,7 @@ func TestAWSProvider_TestGetPublicIPv4(t *testing.T) {
 	server := test.CreateMockAWSServer()
 	defer server.Close()
 
-	provider := newAWSProvider(server.URL)
+	provider := NewAWSProvider(WithBaseURL(server.URL))
 	ctx := context.Background()
 
 	ip, err := provider.GetPublicIPv4(ctx)
@@ -97,3 +105,400 @@ func TestAWSProvider_TestGetPublicIPv4(t *testing.T) {
 		t.Errorf("Expected IP %s, got %s", expectedIP, ip)
 	}
 }
+
+func TestAWSProvider_TestGetPlacement(t *testing.T) {
+	server := test.CreateMockAWSServer()
+	defer server.Close()
+
+	provider := NewAWSProvider(WithBaseURL(server.URL))
+	ctx := context.Background()
+
+	region, err := provider.GetRegion(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if region != "us-west-2" {
+		t.Errorf("Expected region us-west-2, got %s", region)
+	}
+
+	zone, err := provider.GetZone(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if zone != "us-west-2a" {
+		t.Errorf("Expected zone us-west-2a, got %s", zone)
+	}
+}
+
+func TestAWSProvider_TestGetMachine(t *testing.T) {
+	server := test.CreateMockAWSServer()
+	defer server.Close()
+
+	provider := NewAWSProvider(WithBaseURL(server.URL))
+	ctx := context.Background()
+
+	instanceType, err := provider.GetInstanceType(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if instanceType != "m5.large" {
+		t.Errorf("Expected instance type m5.large, got %s", instanceType)
+	}
+
+	imageID, err := provider.GetImageID(ctx)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if imageID != "ami-0abcdef1234567890" {
+		t.Errorf("Expected image ID ami-0abcdef1234567890, got %s", imageID)
+	}
+}
+
+func TestAWSProvider_TestGetAccount(t *testing.T) {
+	server := test.CreateMockAWSServer()
+	defer server.Close()
+
+	provider := NewAWSProvider(WithBaseURL(server.URL))
+
+	account, err := provider.GetAccount(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if account.ID != "123456789012" {
+		t.Errorf("Expected account ID 123456789012, got %s", account.ID)
+	}
+}
+
+func TestAWSProvider_TestGetTags(t *testing.T) {
+	server := test.CreateMockAWSServer()
+	defer server.Close()
+
+	provider := NewAWSProvider(WithBaseURL(server.URL))
+
+	tags, err := provider.GetTags(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := map[string]string{"Name": "web-1", "Environment": "production"}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("Expected tags %v, got %v", want, tags)
+	}
+}
+
+func TestAWSProvider_TestGetTagsDisabled(t *testing.T) {
+	server := test.CreateMockAWSServerWithOptions(test.AWSMockOptions{TagsDisabled: true})
+	defer server.Close()
+
+	provider := NewAWSProvider(WithBaseURL(server.URL))
+
+	if _, err := provider.GetTags(context.Background()); !errors.Is(err, ErrTagsDisabled) {
+		t.Fatalf("Expected ErrTagsDisabled, got %v", err)
+	}
+}
+
+func TestAWSProvider_TestGetSSHKeys(t *testing.T) {
+	server := test.CreateMockAWSServer()
+	defer server.Close()
+
+	provider := NewAWSProvider(WithBaseURL(server.URL))
+
+	keys, err := provider.GetSSHKeys(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []SSHKey{{Type: "ssh-ed25519", Key: "AAAAC3NzaC1lZDI1NTE5AAAAIAABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4f", Comment: "my-key"}}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("Expected keys %v, got %v", want, keys)
+	}
+}
+
+func TestAWSProvider_GetSSHKeysListing(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		listing  string
+		wantKeys int
+		wantErr  error
+	}{
+		{name: "no key pairs", status: http.StatusNotFound, wantErr: ErrNotFound},
+		{name: "line without index", status: http.StatusOK, listing: "0=my-key\nmy-key\n", wantKeys: 1, wantErr: ErrMalformedSSHKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := test.CreateMockAWSServer()
+			defer server.Close()
+
+			handler := server.Config.Handler
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/latest/meta-data/public-keys/" {
+					w.WriteHeader(tt.status)
+					w.Write([]byte(tt.listing))
+					return
+				}
+				handler.ServeHTTP(w, r)
+			})
+
+			keys, err := NewAWSProvider(WithBaseURL(server.URL)).GetSSHKeys(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if len(keys) != tt.wantKeys {
+				t.Errorf("Expected %d keys, got %v", tt.wantKeys, keys)
+			}
+		})
+	}
+}
+
+func TestAWSProvider_TestGetNetworkInterfaces(t *testing.T) {
+	server := test.CreateMockAWSServer()
+	defer server.Close()
+
+	provider := NewAWSProvider(WithBaseURL(server.URL))
+
+	nics, err := provider.GetNetworkInterfaces(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []NetworkInterface{
+		{
+			ID:             "eni-0123456789abcdef0",
+			MAC:            "0e:aa:bb:cc:dd:01",
+			DeviceIndex:    0,
+			PrivateIPv4s:   []string{"10.0.1.100", "10.0.1.101"},
+			PublicIPv4s:    []string{"54.123.45.67"},
+			IPv6s:          []string{"2001:db8:85a3::8a2e:370:7334"},
+			IPv6Prefixes:   []string{"2600:1f14:abc:de00::/80"},
+			SubnetCIDR:     "10.0.1.0/24",
+			NetworkID:      "vpc-0abc",
+			SecurityGroups: []string{"sg-01", "sg-02"},
+		},
+		{
+			ID:           "eni-0fedcba9876543210",
+			MAC:          "0e:aa:bb:cc:dd:02",
+			DeviceIndex:  1,
+			PrivateIPv4s: []string{"10.0.2.50"},
+			SubnetCIDR:   "10.0.2.0/24",
+			NetworkID:    "vpc-0abc",
+		},
+	}
+	if !reflect.DeepEqual(nics, want) {
+		t.Errorf("Expected interfaces\n%+v\ngot\n%+v", want, nics)
+	}
+}
+
+func TestAWSProvider_TestGetUserData(t *testing.T) {
+	server := test.CreateMockAWSServer()
+	defer server.Close()
+
+	provider := NewAWSProvider(WithBaseURL(server.URL))
+
+	data, err := provider.GetUserData(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(data) != test.AWSUserData {
+		t.Errorf("Expected user data %q, got %q", test.AWSUserData, data)
+	}
+
+	provider = NewAWSProvider(WithBaseURL(server.URL), WithRawUserData())
+
+	data, err = provider.GetUserData(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !gunzip.Is(data) {
+		t.Errorf("Expected gzip compressed user data, got %q", data)
+	}
+}
+
+// countTokenRequests wraps the server's handler to count IMDSv2 token requests
+func countTokenRequests(server *httptest.Server) *atomic.Int32 {
+	var count atomic.Int32
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			count.Add(1)
+		}
+		handler.ServeHTTP(w, r)
+	})
+	return &count
+}
+
+func TestAWSProvider_TokenCaching(t *testing.T) {
+	server := test.CreateMockAWSServer()
+	defer server.Close()
+	tokenRequests := countTokenRequests(server)
+
+	provider := NewAWSProvider(WithBaseURL(server.URL))
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := provider.GetInstanceID(ctx); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := tokenRequests.Load(); got != 1 {
+		t.Errorf("Expected 1 token request, got %d", got)
+	}
+}
+
+func TestAWSProvider_TokenRefresh(t *testing.T) {
+	server := test.CreateMockAWSServer()
+	defer server.Close()
+	tokenRequests := countTokenRequests(server)
+
+	provider := NewAWSProvider(WithBaseURL(server.URL), WithAWSTokenTTL(time.Minute))
+	ctx := context.Background()
+
+	if _, err := provider.GetInstanceID(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Token is within the refresh window
+	provider.tokenExpiry = time.Now().Add(time.Second)
+
+	if _, err := provider.GetInstanceID(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := tokenRequests.Load(); got != 2 {
+		t.Errorf("Expected 2 token requests, got %d", got)
+	}
+}
+
+func TestAWSProvider_TokenRejected(t *testing.T) {
+	server := test.CreateMockAWSServer()
+	defer server.Close()
+	tokenRequests := countTokenRequests(server)
+
+	provider := NewAWSProvider(WithBaseURL(server.URL))
+	provider.token = "stale"
+	provider.tokenExpiry = time.Now().Add(time.Hour)
+
+	id, err := provider.GetInstanceID(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if id != "i-1234567890abcdef0" {
+		t.Errorf("Expected instance ID i-1234567890abcdef0, got %s", id)
+	}
+	if got := tokenRequests.Load(); got != 1 {
+		t.Errorf("Expected 1 token request, got %d", got)
+	}
+}
+
+func TestAWSProvider_HopLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		opts test.AWSMockOptions
+	}{
+		{name: "IMDSv2 required", opts: test.AWSMockOptions{DropTokenResponses: true}},
+		{name: "IMDSv1 allowed", opts: test.AWSMockOptions{DropTokenResponses: true, AllowIMDSv1: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := test.CreateMockAWSServerWithOptions(tt.opts)
+			defer server.Close()
+
+			provider := NewAWSProvider(WithBaseURL(server.URL))
+			if _, err := provider.GetInstanceID(context.Background()); !errors.Is(err, ErrIMDSHopLimit) {
+				t.Fatalf("Expected ErrIMDSHopLimit, got %v", err)
+			}
+
+			detector := NewDetector(WithBaseURL(server.URL), WithDMIRoot(""), WithProviders("aws"))
+			if _, err := detector.Detect(context.Background()); !errors.Is(err, ErrIMDSHopLimit) {
+				t.Fatalf("Expected detection to fail with ErrIMDSHopLimit, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAWSProvider_HopLimitNotIMDS(t *testing.T) {
+	tests := []struct {
+		name string
+		opts test.AWSMockOptions
+		// server replaces the Server header of the responses
+		server string
+	}{
+		{name: "other metadata service", opts: test.AWSMockOptions{DropTokenResponses: true, AllowIMDSv1: true}, server: "Metadata Server for VM"},
+		{name: "other service rejecting", opts: test.AWSMockOptions{DropTokenResponses: true}, server: "nginx"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := test.CreateMockAWSServerWithOptions(tt.opts)
+			defer server.Close()
+			if tt.server != "" {
+				handler := server.Config.Handler
+				server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					handler.ServeHTTP(serverHeaderWriter{w, tt.server}, r)
+				})
+			}
+
+			provider := NewAWSProvider(WithBaseURL(server.URL), WithTimeout(200*time.Millisecond))
+			_, err := provider.GetInstanceID(context.Background())
+			if err == nil || errors.Is(err, ErrIMDSHopLimit) {
+				t.Fatalf("Expected the token timeout, got %v", err)
+			}
+		})
+	}
+}
+
+// serverHeaderWriter replaces the Server header set by the handler
+type serverHeaderWriter struct {
+	http.ResponseWriter
+	server string
+}
+
+func (w serverHeaderWriter) WriteHeader(code int) {
+	w.Header().Set("Server", w.server)
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func TestAWSProvider_IMDSv1Fallback(t *testing.T) {
+	server := test.CreateMockAWSServerWithOptions(test.AWSMockOptions{
+		DropTokenResponses: true,
+		AllowIMDSv1:        true,
+	})
+	defer server.Close()
+
+	detector := NewDetector(WithBaseURL(server.URL), WithDMIRoot(""), WithProviders("aws"), WithAWSIMDSv1Fallback())
+	provider, err := detector.Detect(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to detect provider: %v", err)
+	}
+
+	ip, err := provider.GetPrivateIPv4(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ip != "10.0.1.100" {
+		t.Errorf("Expected IP 10.0.1.100, got %s", ip)
+	}
+
+	// A rejected IMDSv1 request has no token to replace, so it isn't retried
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/meta-data/hostname" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+	requests := countRequests(server, "/latest/meta-data/hostname")
+	if _, err := provider.GetHostname(context.Background()); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("Expected 1 request, got %d", got)
+	}
+}
@@ -2,76 +2,90 @@ package cloudmeta
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
-	"time"
 )
 
 const azureMetadataURL = "http://169.254.169.254"
 
 type AzureProvider struct {
-	baseURL    string
-	apiVersion string
-	client     *http.Client
+	baseURL     string
+	apiVersion  string
+	client      *http.Client
+	retry       RetryPolicy
+	rawUserData bool
 }
 
 func (p *AzureProvider) Name() string {
 	return "azure"
 }
 
-func newAzureProvider(baseURL ...string) *AzureProvider {
-	url := azureMetadataURL
-	if len(baseURL) > 0 && baseURL[0] != "" {
-		url = strings.TrimSuffix(baseURL[0], "/")
-	}
+// NewAzureProvider creates a provider for the Azure Instance Metadata Service
+func NewAzureProvider(opts ...Option) *AzureProvider {
+	cfg := newConfig(opts...)
 
 	return &AzureProvider{
-		client:     &http.Client{Timeout: 2 * time.Second},
-		baseURL:    url,
-		apiVersion: "2025-04-07",
+		client:      cfg.httpClient(),
+		retry:       cfg.retry,
+		rawUserData: cfg.rawUserData,
+		baseURL:     cfg.url(azureMetadataURL, ""),
+		apiVersion:  cfg.azureAPIVersion,
 	}
 }
 
-func detectAzure(ctx context.Context, baseURL ...string) Provider {
-	provider := newAzureProvider(baseURL...)
+func detectAzure(ctx context.Context, opts ...Option) (Provider, error) {
+	for _, opts := range endpointOptions(opts, azureMetadataURL, "") {
+		provider := NewAzureProvider(opts...)
 
-	// Try to get VM ID - if successful, we're on Azure
-	_, err := provider.GetInstanceID(ctx)
-	if err == nil {
-		return provider
+		// Try to get VM ID - if successful, we're on Azure
+		_, err := provider.GetInstanceID(ctx)
+		if err == nil {
+			return provider, nil
+		}
 	}
 
-	return nil
+	return nil, nil
 }
 
 func (p *AzureProvider) fetch(ctx context.Context, path string) (string, error) {
-	fullPath := fmt.Sprintf("%s%s?api-version=%s&format=text", p.baseURL, path, p.apiVersion)
-	req, _ := http.NewRequestWithContext(ctx, "GET", fullPath, nil)
+	body, err := p.request(ctx, path, "text")
+	if err != nil {
+		return "", err
+	}
 
-	// Azure Metadata service requires this header
-	req.Header.Set("Metadata", "true")
+	return strings.TrimSpace(string(body)), nil
+}
 
-	resp, err := p.client.Do(req)
+// fetchJSON reads a metadata object and decodes it into v
+func (p *AzureProvider) fetchJSON(ctx context.Context, path string, v any) error {
+	body, err := p.request(ctx, path, "json")
 	if err != nil {
-		return "", err
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
-		return "", ErrNotFound
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("azure: decoding %s: %w", path, err)
 	}
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	return nil
+}
+
+func (p *AzureProvider) request(ctx context.Context, path, format string) ([]byte, error) {
+	fullPath := fmt.Sprintf("%s%s?api-version=%s&format=%s", p.baseURL, path, p.apiVersion, format)
+	req, err := http.NewRequestWithContext(ctx, "GET", fullPath, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	body, _ := io.ReadAll(resp.Body)
-	return strings.TrimSpace(string(body)), nil
+	// Azure Metadata service requires this header
+	req.Header.Set("Metadata", "true")
+
+	return fetchBody(p.client, p.retry, p.Name(), path, req)
 }
 
 func (p *AzureProvider) GetInstanceID(ctx context.Context) (string, error) {
-	return p.fetch(ctx, "/metadata/instance/compute/vmId")
+	return nonEmpty(p.fetch(ctx, "/metadata/instance/compute/vmId"))
 }
 
 func (p *AzureProvider) GetPrivateIPv4(ctx context.Context) (string, error) {
@@ -83,9 +97,307 @@ func (p *AzureProvider) GetPublicIPv4(ctx context.Context) (string, error) {
 }
 
 func (p *AzureProvider) GetHostname(ctx context.Context) (string, error) {
-	return p.fetch(ctx, "/metadata/instance/compute/name")
+	return nonEmpty(p.fetch(ctx, "/metadata/instance/compute/name"))
 }
 
 func (p *AzureProvider) GetPrimaryIPv6(ctx context.Context) (string, error) {
 	return p.fetch(ctx, "/metadata/instance/network/interface/0/ipv6/ipAddress/0/publicIpAddress")
 }
+
+func (p *AzureProvider) GetRegion(ctx context.Context) (string, error) {
+	return nonEmpty(p.fetch(ctx, "/metadata/instance/compute/location"))
+}
+
+// GetZone returns the availability zone, or ErrNotFound for VMs that
+// aren't deployed to one
+func (p *AzureProvider) GetZone(ctx context.Context) (string, error) {
+	return nonEmpty(p.fetch(ctx, "/metadata/instance/compute/zone"))
+}
+
+// GetInstanceType returns the VM size, e.g. Standard_D2s_v5
+func (p *AzureProvider) GetInstanceType(ctx context.Context) (string, error) {
+	return nonEmpty(p.fetch(ctx, "/metadata/instance/compute/vmSize"))
+}
+
+// GetImageID returns the resource ID of a custom image, or the
+// publisher:offer:sku:version URN of a marketplace image
+func (p *AzureProvider) GetImageID(ctx context.Context) (string, error) {
+	var ref azureImageReference
+	if err := p.fetchJSON(ctx, "/metadata/instance/compute/storageProfile/imageReference", &ref); err != nil {
+		return "", err
+	}
+	return ref.imageID()
+}
+
+type azureImageReference struct {
+	ID        string `json:"id"`
+	Publisher string `json:"publisher"`
+	Offer     string `json:"offer"`
+	SKU       string `json:"sku"`
+	Version   string `json:"version"`
+}
+
+func (ref azureImageReference) imageID() (string, error) {
+	if ref.ID != "" {
+		return ref.ID, nil
+	}
+	if ref.Publisher == "" {
+		return "", ErrNotFound
+	}
+	return strings.Join([]string{ref.Publisher, ref.Offer, ref.SKU, ref.Version}, ":"), nil
+}
+
+// GetAccount returns the subscription ID and resource group
+func (p *AzureProvider) GetAccount(ctx context.Context) (*Account, error) {
+	var compute azureCompute
+	if err := p.fetchJSON(ctx, "/metadata/instance/compute", &compute); err != nil {
+		return nil, err
+	}
+	return compute.account()
+}
+
+// azureCompute holds the fields of the compute document used by the
+// provider
+type azureCompute struct {
+	VMID              string              `json:"vmId"`
+	Name              string              `json:"name"`
+	Location          string              `json:"location"`
+	Zone              string              `json:"zone"`
+	VMSize            string              `json:"vmSize"`
+	SubscriptionID    string              `json:"subscriptionId"`
+	ResourceGroupName string              `json:"resourceGroupName"`
+	TagsList          []azureTag          `json:"tagsList"`
+	PublicKeys        []azurePublicKey    `json:"publicKeys"`
+	StorageProfile    azureStorageProfile `json:"storageProfile"`
+}
+
+type azureStorageProfile struct {
+	ImageReference azureImageReference `json:"imageReference"`
+}
+
+func (c *azureCompute) account() (*Account, error) {
+	if c.SubscriptionID == "" {
+		return nil, ErrNotFound
+	}
+
+	return &Account{
+		ID:            c.SubscriptionID,
+		ResourceGroup: c.ResourceGroupName,
+	}, nil
+}
+
+func (p *AzureProvider) GetTags(ctx context.Context) (map[string]string, error) {
+	var list []azureTag
+	if err := p.fetchJSON(ctx, "/metadata/instance/compute/tagsList", &list); err != nil {
+		return nil, err
+	}
+	return azureTags(list), nil
+}
+
+type azureTag struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func azureTags(list []azureTag) map[string]string {
+	tags := make(map[string]string, len(list))
+	for _, tag := range list {
+		tags[tag.Name] = tag.Value
+	}
+	return tags
+}
+
+// GetUserData returns the user data of the VM. IMDS serves it base64
+// encoded; it's decoded unless WithRawUserData is set.
+func (p *AzureProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	data, err := p.request(ctx, "/metadata/instance/compute/userData", "text")
+	if err != nil {
+		return nil, err
+	}
+	return decodeUserData(data, true, p.rawUserData)
+}
+
+// GetSSHKeys returns the public keys of the VM, with the user taken from
+// the authorized_keys path they were installed to
+func (p *AzureProvider) GetSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	var list []azurePublicKey
+	if err := p.fetchJSON(ctx, "/metadata/instance/compute/publicKeys", &list); err != nil {
+		return nil, err
+	}
+	return azureSSHKeys(list)
+}
+
+type azurePublicKey struct {
+	KeyData string `json:"keyData"`
+	Path    string `json:"path"`
+}
+
+func azureSSHKeys(list []azurePublicKey) ([]SSHKey, error) {
+	var keys sshKeys
+	for _, key := range list {
+		// Installed to /home/<user>/.ssh/authorized_keys
+		var user string
+		if rest, ok := strings.CutPrefix(key.Path, "/home/"); ok {
+			user, _, _ = strings.Cut(rest, "/")
+		}
+		keys.add(key.KeyData, user, "")
+	}
+	return keys.result()
+}
+
+// GetNetworkInterfaces returns the NICs of the VM. IMDS doesn't expose
+// the VNet, gateway or network security groups.
+func (p *AzureProvider) GetNetworkInterfaces(ctx context.Context) ([]NetworkInterface, error) {
+	var list []azureInterface
+	if err := p.fetchJSON(ctx, "/metadata/instance/network/interface", &list); err != nil {
+		return nil, err
+	}
+	return azureInterfaces(list), nil
+}
+
+type azureAddress struct {
+	PrivateIPAddress string `json:"privateIpAddress"`
+	PublicIPAddress  string `json:"publicIpAddress"`
+}
+
+type azureInterface struct {
+	MACAddress string `json:"macAddress"`
+	IPv4       struct {
+		IPAddress []azureAddress `json:"ipAddress"`
+		Subnet    []struct {
+			Address string `json:"address"`
+			Prefix  string `json:"prefix"`
+		} `json:"subnet"`
+	} `json:"ipv4"`
+	IPv6 struct {
+		IPAddress []azureAddress `json:"ipAddress"`
+	} `json:"ipv6"`
+}
+
+func azureInterfaces(list []azureInterface) []NetworkInterface {
+	nics := make([]NetworkInterface, 0, len(list))
+	for i, n := range list {
+		nic := NetworkInterface{
+			MAC:         normalizeMAC(n.MACAddress),
+			DeviceIndex: i,
+		}
+		for _, a := range n.IPv4.IPAddress {
+			nic.PrivateIPv4s = appendNonEmpty(nic.PrivateIPv4s, a.PrivateIPAddress)
+			nic.PublicIPv4s = appendNonEmpty(nic.PublicIPv4s, a.PublicIPAddress)
+		}
+		for _, a := range n.IPv6.IPAddress {
+			nic.IPv6s = appendNonEmpty(nic.IPv6s, a.PrivateIPAddress, a.PublicIPAddress)
+		}
+		if len(n.IPv4.Subnet) > 0 {
+			nic.SubnetCIDR = subnetCIDR(n.IPv4.Subnet[0].Address, n.IPv4.Subnet[0].Prefix)
+		}
+		nics = append(nics, nic)
+	}
+	return nics
+}
+
+// GetIPv6Addresses returns the IPv6 addresses of every NIC, public and private
+func (p *AzureProvider) GetIPv6Addresses(ctx context.Context) ([]string, error) {
+	return ipv6Addresses(ctx, p)
+}
+
+// GetIPv6Prefixes returns ErrNotFound, Azure doesn't delegate IPv6 prefixes to VMs
+func (p *AzureProvider) GetIPv6Prefixes(ctx context.Context) ([]string, error) {
+	return nil, ErrNotFound
+}
+
+func (p *AzureProvider) ipv6PrefixesFromInterfaces() bool {
+	return false
+}
+
+// azureDocument answers from the instance document, read with a single
+// request
+type azureDocument struct {
+	*AzureProvider
+
+	Compute azureCompute `json:"compute"`
+	Network struct {
+		Interface []azureInterface `json:"interface"`
+	} `json:"network"`
+}
+
+func (p *AzureProvider) readDocument(ctx context.Context) (Provider, error) {
+	doc := &azureDocument{AzureProvider: p}
+	if err := p.fetchJSON(ctx, "/metadata/instance", doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// address returns the first address of the given family on the primary
+// NIC
+func (d *azureDocument) address(ipv6 bool) azureAddress {
+	if len(d.Network.Interface) == 0 {
+		return azureAddress{}
+	}
+
+	addresses := d.Network.Interface[0].IPv4.IPAddress
+	if ipv6 {
+		addresses = d.Network.Interface[0].IPv6.IPAddress
+	}
+	if len(addresses) == 0 {
+		return azureAddress{}
+	}
+	return addresses[0]
+}
+
+func (d *azureDocument) GetInstanceID(ctx context.Context) (string, error) {
+	return nonEmpty(d.Compute.VMID, nil)
+}
+
+func (d *azureDocument) GetHostname(ctx context.Context) (string, error) {
+	return nonEmpty(d.Compute.Name, nil)
+}
+
+func (d *azureDocument) GetPrivateIPv4(ctx context.Context) (string, error) {
+	return nonEmpty(d.address(false).PrivateIPAddress, nil)
+}
+
+func (d *azureDocument) GetPublicIPv4(ctx context.Context) (string, error) {
+	return nonEmpty(d.address(false).PublicIPAddress, nil)
+}
+
+func (d *azureDocument) GetPrimaryIPv6(ctx context.Context) (string, error) {
+	return nonEmpty(d.address(true).PublicIPAddress, nil)
+}
+
+func (d *azureDocument) GetIPv6Addresses(ctx context.Context) ([]string, error) {
+	return ipv6Addresses(ctx, d)
+}
+
+func (d *azureDocument) GetRegion(ctx context.Context) (string, error) {
+	return nonEmpty(d.Compute.Location, nil)
+}
+
+func (d *azureDocument) GetZone(ctx context.Context) (string, error) {
+	return nonEmpty(d.Compute.Zone, nil)
+}
+
+func (d *azureDocument) GetInstanceType(ctx context.Context) (string, error) {
+	return nonEmpty(d.Compute.VMSize, nil)
+}
+
+func (d *azureDocument) GetImageID(ctx context.Context) (string, error) {
+	return d.Compute.StorageProfile.ImageReference.imageID()
+}
+
+func (d *azureDocument) GetAccount(ctx context.Context) (*Account, error) {
+	return d.Compute.account()
+}
+
+func (d *azureDocument) GetTags(ctx context.Context) (map[string]string, error) {
+	return azureTags(d.Compute.TagsList), nil
+}
+
+func (d *azureDocument) GetSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	return azureSSHKeys(d.Compute.PublicKeys)
+}
+
+func (d *azureDocument) GetNetworkInterfaces(ctx context.Context) ([]NetworkInterface, error) {
+	return azureInterfaces(d.Network.Interface), nil
+}
@@ -2,66 +2,68 @@ package cloudmeta
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
-	"time"
 )
 
 const digitalOceanMetadataURL = "http://169.254.169.254"
 
 type DigitalOceanProvider struct {
-	baseURL string
-	client  *http.Client
+	baseURL     string
+	client      *http.Client
+	retry       RetryPolicy
+	rawUserData bool
 }
 
 func (p *DigitalOceanProvider) Name() string {
 	return "digitalocean"
 }
 
-func newDigitalOceanProvider(baseURL ...string) *DigitalOceanProvider {
-	url := digitalOceanMetadataURL
-	if len(baseURL) > 0 && baseURL[0] != "" {
-		url = strings.TrimSuffix(baseURL[0], "/")
-	}
+// NewDigitalOceanProvider creates a provider for the DigitalOcean droplet metadata service
+func NewDigitalOceanProvider(opts ...Option) *DigitalOceanProvider {
+	cfg := newConfig(opts...)
 
 	return &DigitalOceanProvider{
-		client:  &http.Client{Timeout: 2 * time.Second},
-		baseURL: url,
+		client:      cfg.httpClient(),
+		retry:       cfg.retry,
+		rawUserData: cfg.rawUserData,
+		baseURL:     cfg.url(digitalOceanMetadataURL, ""),
 	}
 }
 
-func detectDigitalOcean(ctx context.Context, baseURL ...string) Provider {
-	provider := newDigitalOceanProvider(baseURL...)
+func detectDigitalOcean(ctx context.Context, opts ...Option) (Provider, error) {
+	for _, opts := range endpointOptions(opts, digitalOceanMetadataURL, "") {
+		provider := NewDigitalOceanProvider(opts...)
 
-	// Try to get droplet ID - if successful, we're on DigitalOcean
-	_, err := provider.GetInstanceID(ctx)
-	if err == nil {
-		return provider
+		// Try to get droplet ID - if successful, we're on DigitalOcean
+		_, err := provider.GetInstanceID(ctx)
+		if err == nil {
+			return provider, nil
+		}
 	}
 
-	return nil
+	return nil, nil
 }
 
 func (p *DigitalOceanProvider) fetch(ctx context.Context, path string) (string, error) {
-	req, _ := http.NewRequestWithContext(ctx, "GET", p.baseURL+path, nil)
-
-	resp, err := p.client.Do(req)
+	body, err := p.fetchRaw(ctx, path)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
-		return "", ErrNotFound
-	}
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	return strings.TrimSpace(string(body)), nil
+}
+
+// fetchRaw reads path without trimming the response
+func (p *DigitalOceanProvider) fetchRaw(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+path, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	body, _ := io.ReadAll(resp.Body)
-	return strings.TrimSpace(string(body)), nil
+	return fetchBody(p.client, p.retry, p.Name(), path, req)
 }
 
 func (p *DigitalOceanProvider) GetInstanceID(ctx context.Context) (string, error) {
@@ -83,3 +85,242 @@ func (p *DigitalOceanProvider) GetHostname(ctx context.Context) (string, error)
 func (p *DigitalOceanProvider) GetPrimaryIPv6(ctx context.Context) (string, error) {
 	return p.fetch(ctx, "/metadata/v1/interfaces/public/0/ipv6/address")
 }
+
+func (p *DigitalOceanProvider) GetRegion(ctx context.Context) (string, error) {
+	return p.fetch(ctx, "/metadata/v1/region")
+}
+
+// GetZone returns ErrNotFound, DigitalOcean has no availability zones
+func (p *DigitalOceanProvider) GetZone(ctx context.Context) (string, error) {
+	return "", ErrNotFound
+}
+
+// GetInstanceType returns ErrNotFound, droplet metadata doesn't include the size
+func (p *DigitalOceanProvider) GetInstanceType(ctx context.Context) (string, error) {
+	return "", ErrNotFound
+}
+
+// GetImageID returns ErrNotFound, droplet metadata doesn't include the image
+func (p *DigitalOceanProvider) GetImageID(ctx context.Context) (string, error) {
+	return "", ErrNotFound
+}
+
+// GetAccount returns ErrNotFound, droplet metadata doesn't identify the team
+func (p *DigitalOceanProvider) GetAccount(ctx context.Context) (*Account, error) {
+	return nil, ErrNotFound
+}
+
+// GetTags returns the droplet tags. DigitalOcean tags have no values, so
+// every tag maps to an empty string.
+func (p *DigitalOceanProvider) GetTags(ctx context.Context) (map[string]string, error) {
+	list, err := p.fetch(ctx, "/metadata/v1/tags")
+	if err != nil {
+		return nil, err
+	}
+	return digitalOceanTags(strings.Split(list, "\n")), nil
+}
+
+func digitalOceanTags(list []string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range list {
+		if tag != "" {
+			tags[tag] = ""
+		}
+	}
+	return tags
+}
+
+func (p *DigitalOceanProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	data, err := p.fetchRaw(ctx, "/metadata/v1/user-data")
+	if err != nil {
+		return nil, err
+	}
+	return decodeUserData(data, false, p.rawUserData)
+}
+
+func (p *DigitalOceanProvider) GetSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	list, err := p.fetch(ctx, "/metadata/v1/public-keys")
+	if err != nil {
+		return nil, err
+	}
+
+	var keys sshKeys
+	keys.addLines(list)
+	return keys.result()
+}
+
+// GetNetworkInterfaces returns the public interface followed by the
+// private (VPC) one. The anchor IP used by reserved IPs is listed as a
+// private address of the public interface.
+func (p *DigitalOceanProvider) GetNetworkInterfaces(ctx context.Context) ([]NetworkInterface, error) {
+	md, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return md.networkInterfaces(), nil
+}
+
+type digitalOceanIPv4 struct {
+	IPAddress string `json:"ip_address"`
+	Netmask   string `json:"netmask"`
+	Gateway   string `json:"gateway"`
+}
+
+type digitalOceanInterface struct {
+	MAC        string            `json:"mac"`
+	IPv4       *digitalOceanIPv4 `json:"ipv4"`
+	AnchorIPv4 *digitalOceanIPv4 `json:"anchor_ipv4"`
+	IPv6       *struct {
+		IPAddress string `json:"ip_address"`
+	} `json:"ipv6"`
+}
+
+// digitalOceanMetadata holds the fields of /metadata/v1.json used by the
+// provider
+type digitalOceanMetadata struct {
+	DropletID  json.Number `json:"droplet_id"`
+	Hostname   string      `json:"hostname"`
+	Region     string      `json:"region"`
+	PublicKeys []string    `json:"public_keys"`
+	Tags       []string    `json:"tags"`
+	Interfaces struct {
+		Public  []digitalOceanInterface `json:"public"`
+		Private []digitalOceanInterface `json:"private"`
+	} `json:"interfaces"`
+}
+
+// metadata reads and decodes /metadata/v1.json
+func (p *DigitalOceanProvider) metadata(ctx context.Context) (*digitalOceanMetadata, error) {
+	const path = "/metadata/v1.json"
+	body, err := p.fetchRaw(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var md digitalOceanMetadata
+	if err := json.Unmarshal(body, &md); err != nil {
+		return nil, fmt.Errorf("digitalocean: decoding %s: %w", path, err)
+	}
+	return &md, nil
+}
+
+func (md *digitalOceanMetadata) networkInterfaces() []NetworkInterface {
+	var nics []NetworkInterface
+	add := func(n digitalOceanInterface, public bool) {
+		iface := NetworkInterface{
+			MAC:         normalizeMAC(n.MAC),
+			DeviceIndex: len(nics),
+		}
+		if n.IPv4 != nil {
+			if public {
+				iface.PublicIPv4s = appendNonEmpty(nil, n.IPv4.IPAddress)
+			} else {
+				iface.PrivateIPv4s = appendNonEmpty(nil, n.IPv4.IPAddress)
+			}
+			iface.SubnetCIDR = subnetCIDR(n.IPv4.IPAddress, n.IPv4.Netmask)
+			iface.Gateway = n.IPv4.Gateway
+		}
+		if n.AnchorIPv4 != nil {
+			iface.PrivateIPv4s = appendNonEmpty(iface.PrivateIPv4s, n.AnchorIPv4.IPAddress)
+		}
+		if n.IPv6 != nil {
+			iface.IPv6s = appendNonEmpty(nil, n.IPv6.IPAddress)
+		}
+		nics = append(nics, iface)
+	}
+	for _, n := range md.Interfaces.Public {
+		add(n, true)
+	}
+	for _, n := range md.Interfaces.Private {
+		add(n, false)
+	}
+	return nics
+}
+
+// GetIPv6Addresses returns the IPv6 addresses of the public and private
+// interfaces, for droplets with IPv6 enabled
+func (p *DigitalOceanProvider) GetIPv6Addresses(ctx context.Context) ([]string, error) {
+	return ipv6Addresses(ctx, p)
+}
+
+// GetIPv6Prefixes returns ErrNotFound, droplets get single addresses rather than delegated prefixes
+func (p *DigitalOceanProvider) GetIPv6Prefixes(ctx context.Context) ([]string, error) {
+	return nil, ErrNotFound
+}
+
+func (p *DigitalOceanProvider) ipv6PrefixesFromInterfaces() bool {
+	return false
+}
+
+// digitalOceanDocument answers from /metadata/v1.json, read with a single
+// request
+type digitalOceanDocument struct {
+	*DigitalOceanProvider
+	md *digitalOceanMetadata
+}
+
+func (p *DigitalOceanProvider) readDocument(ctx context.Context) (Provider, error) {
+	md, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &digitalOceanDocument{DigitalOceanProvider: p, md: md}, nil
+}
+
+// address returns the first address of the given kind of the first
+// interface in list
+func (d *digitalOceanDocument) address(list []digitalOceanInterface, ipv6 bool) string {
+	switch {
+	case len(list) == 0:
+		return ""
+	case ipv6 && list[0].IPv6 != nil:
+		return list[0].IPv6.IPAddress
+	case !ipv6 && list[0].IPv4 != nil:
+		return list[0].IPv4.IPAddress
+	}
+	return ""
+}
+
+func (d *digitalOceanDocument) GetInstanceID(ctx context.Context) (string, error) {
+	return nonEmpty(d.md.DropletID.String(), nil)
+}
+
+func (d *digitalOceanDocument) GetHostname(ctx context.Context) (string, error) {
+	return nonEmpty(d.md.Hostname, nil)
+}
+
+func (d *digitalOceanDocument) GetPrivateIPv4(ctx context.Context) (string, error) {
+	return nonEmpty(d.address(d.md.Interfaces.Private, false), nil)
+}
+
+func (d *digitalOceanDocument) GetPublicIPv4(ctx context.Context) (string, error) {
+	return nonEmpty(d.address(d.md.Interfaces.Public, false), nil)
+}
+
+func (d *digitalOceanDocument) GetPrimaryIPv6(ctx context.Context) (string, error) {
+	return nonEmpty(d.address(d.md.Interfaces.Public, true), nil)
+}
+
+func (d *digitalOceanDocument) GetIPv6Addresses(ctx context.Context) ([]string, error) {
+	return ipv6Addresses(ctx, d)
+}
+
+func (d *digitalOceanDocument) GetRegion(ctx context.Context) (string, error) {
+	return nonEmpty(d.md.Region, nil)
+}
+
+func (d *digitalOceanDocument) GetTags(ctx context.Context) (map[string]string, error) {
+	return digitalOceanTags(d.md.Tags), nil
+}
+
+func (d *digitalOceanDocument) GetSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	var keys sshKeys
+	for _, key := range d.md.PublicKeys {
+		keys.addLines(key)
+	}
+	return keys.result()
+}
+
+func (d *digitalOceanDocument) GetNetworkInterfaces(ctx context.Context) ([]NetworkInterface, error) {
+	return d.md.networkInterfaces(), nil
+}
@@ -2,88 +2,81 @@ package cloudmeta
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net"
 	"net/http"
+	"path"
+	"slices"
 	"strings"
-	"time"
 )
 
-const gcpMetadataURL = "http://169.254.169.254"
+const (
+	gcpMetadataURL     = "http://169.254.169.254"
+	gcpMetadataIPv6URL = "http://[fd20:ce::254]"
+)
 
 type GCPProvider struct {
-	baseURL string
-	client  *http.Client
+	baseURL     string
+	client      *http.Client
+	retry       RetryPolicy
+	rawUserData bool
 }
 
 func (p *GCPProvider) Name() string {
 	return "gcp"
 }
 
-// newGCPProvider creates a new GCP provider with optional baseURL
-func newGCPProvider(baseURL ...string) *GCPProvider {
-	url := gcpMetadataURL
-	if len(baseURL) > 0 && baseURL[0] != "" {
-		url = strings.TrimSuffix(baseURL[0], "/")
-	}
-
-	client := &http.Client{
-		Timeout: 2 * time.Second,
-		Transport: &http.Transport{
-			DialContext: (&net.Dialer{
-				Timeout: 1 * time.Second,
-			}).DialContext,
-		},
-	}
+// NewGCPProvider creates a provider for the Google Compute Engine metadata server
+func NewGCPProvider(opts ...Option) *GCPProvider {
+	cfg := newConfig(opts...)
 
 	return &GCPProvider{
-		client:  client,
-		baseURL: url,
+		client:      cfg.httpClient(),
+		retry:       cfg.retry,
+		rawUserData: cfg.rawUserData,
+		baseURL:     cfg.url(gcpMetadataURL, gcpMetadataIPv6URL),
 	}
 }
 
 // detectGCP attempts to detect if running on GCP
-func detectGCP(ctx context.Context, baseURL ...string) Provider {
-	provider := newGCPProvider(baseURL...)
+func detectGCP(ctx context.Context, opts ...Option) (Provider, error) {
+	for _, opts := range endpointOptions(opts, gcpMetadataURL, gcpMetadataIPv6URL) {
+		provider := NewGCPProvider(opts...)
 
-	// Try to get instance ID - if successful with correct headers, we're on GCP
-	_, err := provider.GetInstanceID(ctx)
-	if err == nil {
-		return provider
+		// Try to get instance ID - if successful with correct headers, we're on GCP
+		_, err := provider.GetInstanceID(ctx)
+		if err == nil {
+			return provider, nil
+		}
 	}
 
-	return nil
+	return nil, nil
 }
 
 // fetchMetadata makes HTTP requests to GCP metadata service
 func (p *GCPProvider) fetchMetadata(ctx context.Context, path string) (string, error) {
-	url := p.baseURL + path
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	body, err := p.fetchRaw(ctx, path)
 	if err != nil {
 		return "", err
 	}
 
-	// GCP requires this header
-	req.Header.Set("Metadata-Flavor", "Google")
-
-	resp, err := p.client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
+	return strings.TrimSpace(string(body)), nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HTTP %d for %s", resp.StatusCode, path)
-	}
+// fetchRaw reads path without trimming the response
+func (p *GCPProvider) fetchRaw(ctx context.Context, path string) ([]byte, error) {
+	url := p.baseURL + path
 
-	body, err := io.ReadAll(resp.Body)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return strings.TrimSpace(string(body)), nil
+	// GCP requires this header
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	return fetchBody(p.client, p.retry, p.Name(), path, req)
 }
 
 // GetInstanceID returns the GCP instance ID
@@ -124,3 +117,411 @@ func (p *GCPProvider) GetPrimaryIPv6(ctx context.Context) (string, error) {
 	}
 	return ipv6s[0], nil
 }
+
+// GetRegion returns the GCP region, derived from the zone
+func (p *GCPProvider) GetRegion(ctx context.Context) (string, error) {
+	zone, err := p.GetZone(ctx)
+	if err != nil {
+		return "", err
+	}
+	return gcpRegion(zone)
+}
+
+// gcpRegion strips the zone letter, us-central1-a becomes us-central1
+func gcpRegion(zone string) (string, error) {
+	i := strings.LastIndex(zone, "-")
+	if i < 0 {
+		return "", ErrNotFound
+	}
+	return zone[:i], nil
+}
+
+// gcpBase returns the last element of a resource path such as
+// projects/<project-number>/zones/<zone>, or an empty string for an empty
+// path
+func gcpBase(resource string) string {
+	if resource == "" {
+		return ""
+	}
+	return path.Base(resource)
+}
+
+// GetZone returns the zone, e.g. us-central1-a
+func (p *GCPProvider) GetZone(ctx context.Context) (string, error) {
+	// Returned as projects/<project-number>/zones/<zone>
+	zone, err := p.fetchMetadata(ctx, "/computeMetadata/v1/instance/zone")
+	if err != nil {
+		return "", err
+	}
+	return nonEmpty(gcpBase(zone), nil)
+}
+
+// GetInstanceType returns the machine type, e.g. e2-medium
+func (p *GCPProvider) GetInstanceType(ctx context.Context) (string, error) {
+	// Returned as projects/<project-number>/machineTypes/<machine-type>
+	machineType, err := p.fetchMetadata(ctx, "/computeMetadata/v1/instance/machine-type")
+	if err != nil {
+		return "", err
+	}
+	return nonEmpty(gcpBase(machineType), nil)
+}
+
+// GetImageID returns the name of the boot disk image
+func (p *GCPProvider) GetImageID(ctx context.Context) (string, error) {
+	// Returned as projects/<project>/global/images/<image>
+	image, err := p.fetchMetadata(ctx, "/computeMetadata/v1/instance/image")
+	if err != nil {
+		return "", err
+	}
+	return nonEmpty(gcpBase(image), nil)
+}
+
+// GetAccount returns the project ID and number
+func (p *GCPProvider) GetAccount(ctx context.Context) (*Account, error) {
+	id, err := p.fetchMetadata(ctx, "/computeMetadata/v1/project/project-id")
+	if err != nil {
+		return nil, err
+	}
+
+	number, err := p.fetchMetadata(ctx, "/computeMetadata/v1/project/numeric-project-id")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Account{ID: id, ProjectNumber: number}, nil
+}
+
+// GetTags returns the custom metadata attributes of the instance, leaving
+// out those read by GCE guest software such as ssh-keys, user-data and the
+// startup scripts, which can hold secrets. Labels aren't exposed by the
+// metadata server. GetAttributes returns every attribute.
+func (p *GCPProvider) GetTags(ctx context.Context) (map[string]string, error) {
+	attributes, err := p.GetAttributes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return gcpTags(attributes), nil
+}
+
+// GetAttributes returns all custom metadata attributes of the instance
+func (p *GCPProvider) GetAttributes(ctx context.Context) (map[string]string, error) {
+	return p.attributes(ctx, "/computeMetadata/v1/instance/attributes/")
+}
+
+// gcpSystemAttributes are attributes read by GCE guest software rather than
+// set as tags
+var gcpSystemAttributes = []string{
+	"ssh-keys", "sshKeys", "block-project-ssh-keys", "windows-keys",
+	"user-data", "user-data-encoding", "kube-env", "configure-sh",
+	"cluster-name", "cluster-location", "cluster-uid", "created-by",
+	"instance-template", "startup-script", "shutdown-script",
+}
+
+// gcpSystemPrefixes start the names of further system attributes, e.g.
+// startup-script-url, enable-oslogin or windows-startup-script-ps1
+var gcpSystemPrefixes = []string{
+	"startup-script-", "shutdown-script-", "windows-", "sysprep-",
+	"enable-", "serial-port-", "google-", "gce-",
+}
+
+// gcpTags drops the system attributes
+func gcpTags(attributes map[string]string) map[string]string {
+	tags := make(map[string]string, len(attributes))
+	for key, value := range attributes {
+		if slices.Contains(gcpSystemAttributes, key) || slices.ContainsFunc(gcpSystemPrefixes, func(prefix string) bool {
+			return strings.HasPrefix(key, prefix)
+		}) {
+			continue
+		}
+		tags[key] = value
+	}
+	return tags
+}
+
+// attributes reads the instance or project attributes directory at path
+func (p *GCPProvider) attributes(ctx context.Context, path string) (map[string]string, error) {
+	body, err := p.fetchMetadata(ctx, path+"?recursive=true")
+	if err != nil {
+		return nil, err
+	}
+
+	var attributes map[string]string
+	if err := json.Unmarshal([]byte(body), &attributes); err != nil {
+		return nil, fmt.Errorf("gcp: decoding %s: %w", path, err)
+	}
+	if attributes == nil {
+		attributes = make(map[string]string)
+	}
+	return attributes, nil
+}
+
+// GetUserData returns the user-data attribute, falling back to the
+// startup-script attribute when it isn't set. The user-data attribute is
+// decoded when user-data-encoding is base64, unless WithRawUserData is set.
+func (p *GCPProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	data, err := p.fetchRaw(ctx, "/computeMetadata/v1/instance/attributes/user-data")
+	if errors.Is(err, ErrNotFound) {
+		data, err = p.fetchRaw(ctx, "/computeMetadata/v1/instance/attributes/startup-script")
+		if err != nil {
+			return nil, err
+		}
+		return decodeUserData(data, false, p.rawUserData)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	encoding, err := optional(p.fetchMetadata(ctx, "/computeMetadata/v1/instance/attributes/user-data-encoding"))
+	if err != nil {
+		return nil, err
+	}
+	return decodeUserData(data, encoding == "base64", p.rawUserData)
+}
+
+// GetSSHKeys returns the keys in the instance's ssh-keys attribute and,
+// unless block-project-ssh-keys is set, the project's
+func (p *GCPProvider) GetSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	instance, err := p.attributes(ctx, "/computeMetadata/v1/instance/attributes/")
+	if err != nil {
+		return nil, err
+	}
+
+	var project map[string]string
+	if !gcpBlocksProjectKeys(instance) {
+		if project, err = p.attributes(ctx, "/computeMetadata/v1/project/attributes/"); err != nil {
+			return nil, err
+		}
+	}
+	return gcpSSHKeys(instance, project)
+}
+
+func gcpBlocksProjectKeys(instance map[string]string) bool {
+	return strings.EqualFold(instance["block-project-ssh-keys"], "true")
+}
+
+// gcpSSHKeys collects the keys of the instance and project attributes
+func gcpSSHKeys(instance, project map[string]string) ([]SSHKey, error) {
+	var keys sshKeys
+	addGCPKeys(&keys, instance["ssh-keys"])
+	if !gcpBlocksProjectKeys(instance) {
+		addGCPKeys(&keys, project["ssh-keys"])
+	}
+	return keys.result()
+}
+
+// addGCPKeys adds the entries of an ssh-keys attribute, one <user>:<key>
+// per line
+func addGCPKeys(keys *sshKeys, attribute string) {
+	for _, line := range strings.Split(attribute, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		user, key, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			keys.fail(line, "missing user name")
+			continue
+		}
+		keys.add(key, user, "")
+	}
+}
+
+// GetNetworkInterfaces returns the network interfaces of the instance.
+// Alias IP ranges are reported when they're a single address.
+func (p *GCPProvider) GetNetworkInterfaces(ctx context.Context) ([]NetworkInterface, error) {
+	const dir = "/computeMetadata/v1/instance/network-interfaces/"
+	body, err := p.fetchMetadata(ctx, dir+"?recursive=true")
+	if err != nil {
+		return nil, err
+	}
+
+	var list []gcpInterface
+	if err := json.Unmarshal([]byte(body), &list); err != nil {
+		return nil, fmt.Errorf("gcp: decoding %s: %w", dir, err)
+	}
+	return gcpInterfaces(list), nil
+}
+
+// gcpInterface is an entry of the recursive network-interfaces listing
+type gcpInterface struct {
+	MAC           string   `json:"mac"`
+	IP            string   `json:"ip"`
+	IPAliases     []string `json:"ipAliases"`
+	Subnetmask    string   `json:"subnetmask"`
+	Gateway       string   `json:"gateway"`
+	Network       string   `json:"network"`
+	IPv6s         []string `json:"ipv6s"`
+	ExternalIPv6  string   `json:"externalIpv6"`
+	IPv6Prefix    gcpList  `json:"ipv6Prefix"`
+	AccessConfigs []struct {
+		ExternalIP string `json:"externalIp"`
+	} `json:"accessConfigs"`
+}
+
+func gcpInterfaces(list []gcpInterface) []NetworkInterface {
+	nics := make([]NetworkInterface, 0, len(list))
+	for i, n := range list {
+		nic := NetworkInterface{
+			MAC:          normalizeMAC(n.MAC),
+			DeviceIndex:  i,
+			PrivateIPv4s: appendNonEmpty(nil, n.IP),
+			IPv6s:        appendNonEmpty(slices.Clone(n.IPv6s), n.ExternalIPv6),
+			IPv6Prefixes: n.IPv6Prefix,
+			SubnetCIDR:   subnetCIDR(n.IP, n.Subnetmask),
+			Gateway:      n.Gateway,
+			// Returned as projects/<project-number>/networks/<network>
+			NetworkID: gcpBase(n.Network),
+		}
+		for _, alias := range n.IPAliases {
+			if ip, ok := strings.CutSuffix(alias, "/32"); ok {
+				nic.PrivateIPv4s = append(nic.PrivateIPv4s, ip)
+			}
+		}
+		for _, ac := range n.AccessConfigs {
+			nic.PublicIPv4s = appendNonEmpty(nic.PublicIPv4s, ac.ExternalIP)
+		}
+		nics = append(nics, nic)
+	}
+	return nics
+}
+
+// GetIPv6Addresses returns the IPv6 addresses of every network interface
+func (p *GCPProvider) GetIPv6Addresses(ctx context.Context) ([]string, error) {
+	return ipv6Addresses(ctx, p)
+}
+
+// GetIPv6Prefixes returns the IPv6 prefixes assigned to every network
+// interface
+func (p *GCPProvider) GetIPv6Prefixes(ctx context.Context) ([]string, error) {
+	return ipv6Prefixes(ctx, p)
+}
+
+func (p *GCPProvider) ipv6PrefixesFromInterfaces() bool {
+	return true
+}
+
+// gcpList decodes a recursive metadata value that's either a single
+// string or a list of them
+type gcpList []string
+
+func (l *gcpList) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*l = appendNonEmpty(nil, s)
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(l))
+}
+
+// gcpDocument answers from the recursive metadata tree, read with a single
+// request
+type gcpDocument struct {
+	*GCPProvider
+
+	Instance struct {
+		ID                json.Number       `json:"id"`
+		Hostname          string            `json:"hostname"`
+		Zone              string            `json:"zone"`
+		MachineType       string            `json:"machineType"`
+		Image             string            `json:"image"`
+		Attributes        map[string]string `json:"attributes"`
+		NetworkInterfaces []gcpInterface    `json:"networkInterfaces"`
+	} `json:"instance"`
+	Project struct {
+		ProjectID        string            `json:"projectId"`
+		NumericProjectID json.Number       `json:"numericProjectId"`
+		Attributes       map[string]string `json:"attributes"`
+	} `json:"project"`
+}
+
+func (p *GCPProvider) readDocument(ctx context.Context) (Provider, error) {
+	const dir = "/computeMetadata/v1/"
+	body, err := p.fetchMetadata(ctx, dir+"?recursive=true")
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &gcpDocument{GCPProvider: p}
+	if err := json.Unmarshal([]byte(body), doc); err != nil {
+		return nil, fmt.Errorf("gcp: decoding %s: %w", dir, err)
+	}
+	if doc.Instance.Attributes == nil {
+		doc.Instance.Attributes = make(map[string]string)
+	}
+	return doc, nil
+}
+
+func (d *gcpDocument) primary() gcpInterface {
+	if len(d.Instance.NetworkInterfaces) == 0 {
+		return gcpInterface{}
+	}
+	return d.Instance.NetworkInterfaces[0]
+}
+
+func (d *gcpDocument) GetInstanceID(ctx context.Context) (string, error) {
+	return nonEmpty(d.Instance.ID.String(), nil)
+}
+
+func (d *gcpDocument) GetHostname(ctx context.Context) (string, error) {
+	return nonEmpty(d.Instance.Hostname, nil)
+}
+
+func (d *gcpDocument) GetPrivateIPv4(ctx context.Context) (string, error) {
+	return nonEmpty(d.primary().IP, nil)
+}
+
+func (d *gcpDocument) GetPublicIPv4(ctx context.Context) (string, error) {
+	configs := d.primary().AccessConfigs
+	if len(configs) == 0 {
+		return "", ErrNotFound
+	}
+	return nonEmpty(configs[0].ExternalIP, nil)
+}
+
+func (d *gcpDocument) GetPrimaryIPv6(ctx context.Context) (string, error) {
+	return first(d.primary().IPv6s)
+}
+
+func (d *gcpDocument) GetIPv6Addresses(ctx context.Context) ([]string, error) {
+	return ipv6Addresses(ctx, d)
+}
+
+func (d *gcpDocument) GetIPv6Prefixes(ctx context.Context) ([]string, error) {
+	return ipv6Prefixes(ctx, d)
+}
+
+func (d *gcpDocument) GetRegion(ctx context.Context) (string, error) {
+	return gcpRegion(gcpBase(d.Instance.Zone))
+}
+
+func (d *gcpDocument) GetZone(ctx context.Context) (string, error) {
+	return nonEmpty(gcpBase(d.Instance.Zone), nil)
+}
+
+func (d *gcpDocument) GetInstanceType(ctx context.Context) (string, error) {
+	return nonEmpty(gcpBase(d.Instance.MachineType), nil)
+}
+
+func (d *gcpDocument) GetImageID(ctx context.Context) (string, error) {
+	return nonEmpty(gcpBase(d.Instance.Image), nil)
+}
+
+func (d *gcpDocument) GetAccount(ctx context.Context) (*Account, error) {
+	if d.Project.ProjectID == "" {
+		return nil, ErrNotFound
+	}
+	return &Account{ID: d.Project.ProjectID, ProjectNumber: d.Project.NumericProjectID.String()}, nil
+}
+
+func (d *gcpDocument) GetTags(ctx context.Context) (map[string]string, error) {
+	return gcpTags(d.Instance.Attributes), nil
+}
+
+func (d *gcpDocument) GetSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	return gcpSSHKeys(d.Instance.Attributes, d.Project.Attributes)
+}
+
+func (d *gcpDocument) GetNetworkInterfaces(ctx context.Context) ([]NetworkInterface, error) {
+	return gcpInterfaces(d.Instance.NetworkInterfaces), nil
+}
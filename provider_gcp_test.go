@@ -2,6 +2,7 @@ package cloudmeta
 
 import (
 	"context"
+	"net/http"
 	"reflect"
 	"testing"
 
@@ -9,7 +10,7 @@ import (
 )
 
 func TestGCPProvider_Name(t *testing.T) {
-	provider := newGCPProvider()
+	provider := NewGCPProvider()
 	if got := provider.Name(); got != "gcp" {
 		t.Errorf("GCPProvider.Name() = %v, want %v", got, "gcp")
 	}
@@ -19,7 +20,7 @@ func TestGCPProvider_WithMockServer(t *testing.T) {
 	server := test.CreateMockGCPServer()
 	defer server.Close()
 
-	provider := newGCPProvider(server.URL)
+	provider := NewGCPProvider(WithBaseURL(server.URL))
 	ctx := context.Background()
 
 	tt := []struct {
@@ -62,6 +63,119 @@ func TestGCPProvider_WithMockServer(t *testing.T) {
 			},
 			want: "2001:db8:85a3::8a2e:370:7334",
 		},
+		{
+			name: "GetRegion",
+			do: func(p *GCPProvider) (interface{}, error) {
+				return p.GetRegion(ctx)
+			},
+			want: "us-central1",
+		},
+		{
+			name: "GetZone",
+			do: func(p *GCPProvider) (interface{}, error) {
+				return p.GetZone(ctx)
+			},
+			want: "us-central1-a",
+		},
+		{
+			name: "GetInstanceType",
+			do: func(p *GCPProvider) (interface{}, error) {
+				return p.GetInstanceType(ctx)
+			},
+			want: "e2-medium",
+		},
+		{
+			name: "GetImageID",
+			do: func(p *GCPProvider) (interface{}, error) {
+				return p.GetImageID(ctx)
+			},
+			want: "debian-12-bookworm-v20240110",
+		},
+		{
+			name: "GetAccount",
+			do: func(p *GCPProvider) (interface{}, error) {
+				return p.GetAccount(ctx)
+			},
+			want: &Account{ID: "my-test-project", ProjectNumber: "123456789012"},
+		},
+		{
+			name: "GetTags",
+			do: func(p *GCPProvider) (interface{}, error) {
+				return p.GetTags(ctx)
+			},
+			want: map[string]string{
+				"role": "web",
+			},
+		},
+		{
+			name: "GetAttributes",
+			do: func(p *GCPProvider) (interface{}, error) {
+				return p.GetAttributes(ctx)
+			},
+			want: map[string]string{
+				"enable-oslogin": "TRUE",
+				"role":           "web",
+				"ssh-keys":       "alice:ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIAABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4f alice@laptop",
+			},
+		},
+		{
+			name: "GetNetworkInterfaces",
+			do: func(p *GCPProvider) (interface{}, error) {
+				return p.GetNetworkInterfaces(ctx)
+			},
+			want: []NetworkInterface{
+				{
+					MAC:          "42:01:0a:80:00:05",
+					DeviceIndex:  0,
+					PrivateIPv4s: []string{"10.128.0.5", "10.128.0.6"},
+					PublicIPv4s:  []string{"34.123.45.67"},
+					IPv6s:        []string{"2001:db8:85a3::8a2e:370:7334"},
+					IPv6Prefixes: []string{"2600:1900:4000:abcd:0:0::/96"},
+					SubnetCIDR:   "10.128.0.0/20",
+					Gateway:      "10.128.0.1",
+					NetworkID:    "default",
+				},
+				{
+					MAC:          "42:01:0a:81:00:02",
+					DeviceIndex:  1,
+					PrivateIPv4s: []string{"10.129.0.2"},
+					SubnetCIDR:   "10.129.0.0/24",
+					Gateway:      "10.129.0.1",
+					NetworkID:    "backend",
+				},
+			},
+		},
+		{
+			name: "GetIPv6Addresses",
+			do: func(p *GCPProvider) (interface{}, error) {
+				return p.GetIPv6Addresses(ctx)
+			},
+			want: []string{"2001:db8:85a3::8a2e:370:7334"},
+		},
+		{
+			name: "GetIPv6Prefixes",
+			do: func(p *GCPProvider) (interface{}, error) {
+				return p.GetIPv6Prefixes(ctx)
+			},
+			want: []string{"2600:1900:4000:abcd:0:0::/96"},
+		},
+		{
+			name: "GetSSHKeys",
+			do: func(p *GCPProvider) (interface{}, error) {
+				return p.GetSSHKeys(ctx)
+			},
+			want: []SSHKey{
+				{Type: "ssh-ed25519", Key: "AAAAC3NzaC1lZDI1NTE5AAAAIAABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4f", Comment: "alice@laptop", User: "alice"},
+				{Type: "ssh-ed25519", Key: "AAAAC3NzaC1lZDI1NTE5AAAAICAhIiMkJSYnKCkqKywtLi8wMTIzNDU2Nzg5Ojs8PT4/", User: "bob"},
+			},
+		},
+		{
+			name: "GetUserData",
+			do: func(p *GCPProvider) (interface{}, error) {
+				return p.GetUserData(ctx)
+			},
+			want: []byte("#!/bin/sh\necho started\n"),
+		},
 	}
 
 	for _, tc := range tt {
@@ -78,4 +192,49 @@ func TestGCPProvider_WithMockServer(t *testing.T) {
 	}
 }
 
+func TestGCPProvider_GetUserDataEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		userData string
+		encoding string
+		raw      bool
+		want     string
+	}{
+		{name: "plain", userData: "#cloud-config\n", want: "#cloud-config\n"},
+		{name: "base64", userData: "I2Nsb3VkLWNvbmZpZwo=", encoding: "base64", want: "#cloud-config\n"},
+		{name: "base64 raw", userData: "I2Nsb3VkLWNvbmZpZwo=", encoding: "base64", raw: true, want: "I2Nsb3VkLWNvbmZpZwo="},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := test.CreateMockGCPServer()
+			defer server.Close()
+
+			handler := server.Config.Handler
+			server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/computeMetadata/v1/instance/attributes/user-data":
+					w.Write([]byte(tt.userData))
+				case r.URL.Path == "/computeMetadata/v1/instance/attributes/user-data-encoding" && tt.encoding != "":
+					w.Write([]byte(tt.encoding))
+				default:
+					handler.ServeHTTP(w, r)
+				}
+			})
+
+			opts := []Option{WithBaseURL(server.URL)}
+			if tt.raw {
+				opts = append(opts, WithRawUserData())
+			}
+			got, err := NewGCPProvider(opts...).GetUserData(context.Background())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
 // TODO: Test no IPv6
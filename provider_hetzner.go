@@ -2,66 +2,69 @@ package cloudmeta
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"strconv"
 	"strings"
-	"time"
 )
 
 const hetznerMetadataURL = "http://169.254.169.254"
 
 type HetznerProvider struct {
-	baseURL string
-	client  *http.Client
+	baseURL     string
+	client      *http.Client
+	retry       RetryPolicy
+	rawUserData bool
 }
 
 func (p *HetznerProvider) Name() string {
 	return "hetzner"
 }
 
-func newHetznerProvider(baseURL ...string) *HetznerProvider {
-	url := hetznerMetadataURL
-	if len(baseURL) > 0 && baseURL[0] != "" {
-		url = strings.TrimSuffix(baseURL[0], "/")
-	}
+// NewHetznerProvider creates a provider for the Hetzner Cloud metadata service
+func NewHetznerProvider(opts ...Option) *HetznerProvider {
+	cfg := newConfig(opts...)
 
 	return &HetznerProvider{
-		client:  &http.Client{Timeout: 2 * time.Second},
-		baseURL: url,
+		client:      cfg.httpClient(),
+		retry:       cfg.retry,
+		rawUserData: cfg.rawUserData,
+		baseURL:     cfg.url(hetznerMetadataURL, ""),
 	}
 }
 
-func detectHetzner(ctx context.Context, baseURL ...string) Provider {
-	provider := newHetznerProvider(baseURL...)
+func detectHetzner(ctx context.Context, opts ...Option) (Provider, error) {
+	for _, opts := range endpointOptions(opts, hetznerMetadataURL, "") {
+		provider := NewHetznerProvider(opts...)
 
-	// Try to get server ID - if successful, we're on Hetzner
-	_, err := provider.GetInstanceID(ctx)
-	if err == nil {
-		return provider
+		// Try to get server ID - if successful, we're on Hetzner
+		_, err := provider.GetInstanceID(ctx)
+		if err == nil {
+			return provider, nil
+		}
 	}
 
-	return nil
+	return nil, nil
 }
 
 func (p *HetznerProvider) fetch(ctx context.Context, path string) (string, error) {
-	req, _ := http.NewRequestWithContext(ctx, "GET", p.baseURL+path, nil)
-
-	resp, err := p.client.Do(req)
+	body, err := p.fetchRaw(ctx, path)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
-		return "", ErrNotFound
-	}
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	return strings.TrimSpace(string(body)), nil
+}
+
+// fetchRaw reads path without trimming the response
+func (p *HetznerProvider) fetchRaw(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+path, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	body, _ := io.ReadAll(resp.Body)
-	return strings.TrimSpace(string(body)), nil
+	return fetchBody(p.client, p.retry, p.Name(), path, req)
 }
 
 func (p *HetznerProvider) GetInstanceID(ctx context.Context) (string, error) {
@@ -83,3 +86,187 @@ func (p *HetznerProvider) GetHostname(ctx context.Context) (string, error) {
 func (p *HetznerProvider) GetPrimaryIPv6(ctx context.Context) (string, error) {
 	return p.fetch(ctx, "/hetzner/v1/metadata/public-ipv6")
 }
+
+func (p *HetznerProvider) GetRegion(ctx context.Context) (string, error) {
+	return p.fetch(ctx, "/hetzner/v1/metadata/region")
+}
+
+func (p *HetznerProvider) GetZone(ctx context.Context) (string, error) {
+	return p.fetch(ctx, "/hetzner/v1/metadata/availability-zone")
+}
+
+// GetInstanceType returns ErrNotFound, server metadata doesn't include the server type
+func (p *HetznerProvider) GetInstanceType(ctx context.Context) (string, error) {
+	return "", ErrNotFound
+}
+
+// GetImageID returns ErrNotFound, server metadata doesn't include the image
+func (p *HetznerProvider) GetImageID(ctx context.Context) (string, error) {
+	return "", ErrNotFound
+}
+
+// GetAccount returns ErrNotFound, server metadata doesn't identify the project
+func (p *HetznerProvider) GetAccount(ctx context.Context) (*Account, error) {
+	return nil, ErrNotFound
+}
+
+// GetTags returns ErrNotFound, server metadata doesn't include labels
+func (p *HetznerProvider) GetTags(ctx context.Context) (map[string]string, error) {
+	return nil, ErrNotFound
+}
+
+func (p *HetznerProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	data, err := p.fetchRaw(ctx, "/hetzner/v1/userdata")
+	if err != nil {
+		return nil, err
+	}
+	return decodeUserData(data, false, p.rawUserData)
+}
+
+func (p *HetznerProvider) GetSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	const path = "/hetzner/v1/metadata/public-keys"
+	body, err := p.fetchRaw(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []string
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("hetzner: decoding %s: %w", path, err)
+	}
+
+	var keys sshKeys
+	for _, key := range list {
+		keys.add(key, "", "")
+	}
+	return keys.result()
+}
+
+// GetNetworkInterfaces returns the public interface, followed by one
+// interface per attached private network. The metadata service doesn't
+// report the MAC address of the public interface.
+func (p *HetznerProvider) GetNetworkInterfaces(ctx context.Context) ([]NetworkInterface, error) {
+	var public NetworkInterface
+	ipv4, err := optional(p.GetPublicIPv4(ctx))
+	if err != nil {
+		return nil, err
+	}
+	ipv6, err := optional(p.GetPrimaryIPv6(ctx))
+	if err != nil {
+		return nil, err
+	}
+	public.PublicIPv4s = appendNonEmpty(nil, ipv4)
+	public.IPv6s = appendNonEmpty(nil, ipv6)
+
+	const path = "/hetzner/v1/metadata/private-networks"
+	list, err := optional(p.fetch(ctx, path))
+	if err != nil {
+		return nil, err
+	}
+	networks, err := parseHetznerNetworks(list)
+	if err != nil {
+		return nil, fmt.Errorf("hetzner: decoding %s: %w", path, err)
+	}
+
+	nics := []NetworkInterface{public}
+	for _, n := range networks {
+		index, err := strconv.Atoi(n.value("interface_num"))
+		if err != nil {
+			return nil, fmt.Errorf("hetzner: decoding %s: interface_num: %w", path, err)
+		}
+		nics = append(nics, NetworkInterface{
+			MAC:          normalizeMAC(n.value("mac_address")),
+			DeviceIndex:  index,
+			PrivateIPv4s: append(appendNonEmpty(nil, n.value("ip")), n["alias_ips"]...),
+			SubnetCIDR:   n.value("subnet"),
+			Gateway:      n.value("gateway"),
+			NetworkID:    n.value("network_id"),
+		})
+	}
+	return nics, nil
+}
+
+// hetznerNetwork is an entry of the private-networks listing. Every key
+// maps to its values, scalars have one.
+type hetznerNetwork map[string][]string
+
+func (n hetznerNetwork) value(key string) string {
+	if len(n[key]) == 0 {
+		return ""
+	}
+	return n[key][0]
+}
+
+// parseHetznerNetworks reads the private-networks listing, a YAML sequence
+// of flat mappings whose values are scalars or lists of scalars
+func parseHetznerNetworks(text string) ([]hetznerNetwork, error) {
+	var (
+		networks []hetznerNetwork
+		lastKey  string
+	)
+	for i, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "[]" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if rest, ok := strings.CutPrefix(line, "- "); ok {
+			networks = append(networks, make(hetznerNetwork))
+			trimmed = strings.TrimSpace(rest)
+		} else if item, ok := strings.CutPrefix(trimmed, "- "); ok && lastKey != "" {
+			// Block sequence value of the previous key
+			n := networks[len(networks)-1]
+			n[lastKey] = append(n[lastKey], unquote(item))
+			continue
+		}
+		if len(networks) == 0 {
+			return nil, fmt.Errorf("line %d: expected a sequence entry", i+1)
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", i+1)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		lastKey = key
+
+		n := networks[len(networks)-1]
+		switch {
+		case value == "":
+			n[key] = nil
+		case strings.HasPrefix(value, "["):
+			inner := strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+			n[key] = nil
+			for _, item := range strings.Split(inner, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					n[key] = append(n[key], unquote(item))
+				}
+			}
+		default:
+			n[key] = []string{unquote(value)}
+		}
+	}
+	return networks, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// GetIPv6Addresses returns the public IPv6 address, the only one the
+// metadata service exposes
+func (p *HetznerProvider) GetIPv6Addresses(ctx context.Context) ([]string, error) {
+	return ipv6Addresses(ctx, p)
+}
+
+// GetIPv6Prefixes returns ErrNotFound, the metadata service doesn't expose the server's /64
+func (p *HetznerProvider) GetIPv6Prefixes(ctx context.Context) ([]string, error) {
+	return nil, ErrNotFound
+}
+
+func (p *HetznerProvider) ipv6PrefixesFromInterfaces() bool {
+	return false
+}
@@ -2,69 +2,74 @@ package cloudmeta
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
-	"time"
 )
 
-const ociMetadataURL = "http://169.254.169.254"
+const (
+	ociMetadataURL     = "http://169.254.169.254"
+	ociMetadataIPv6URL = "http://[fd00:c1::a9fe:a9fe]"
+)
 
 type OCIProvider struct {
-	baseURL string
-	client  *http.Client
+	baseURL     string
+	client      *http.Client
+	retry       RetryPolicy
+	rawUserData bool
 }
 
 func (p *OCIProvider) Name() string {
 	return "oci"
 }
 
-func newOCIProvider(baseURL ...string) *OCIProvider {
-	url := ociMetadataURL
-	if len(baseURL) > 0 && baseURL[0] != "" {
-		url = strings.TrimSuffix(baseURL[0], "/")
-	}
+// NewOCIProvider creates a provider for the Oracle Cloud Infrastructure instance metadata service (v2)
+func NewOCIProvider(opts ...Option) *OCIProvider {
+	cfg := newConfig(opts...)
 
 	return &OCIProvider{
-		client:  &http.Client{Timeout: 2 * time.Second},
-		baseURL: url,
+		client:      cfg.httpClient(),
+		retry:       cfg.retry,
+		rawUserData: cfg.rawUserData,
+		baseURL:     cfg.url(ociMetadataURL, ociMetadataIPv6URL),
 	}
 }
 
-func detectOCI(ctx context.Context, baseURL ...string) Provider {
-	provider := newOCIProvider(baseURL...)
+func detectOCI(ctx context.Context, opts ...Option) (Provider, error) {
+	for _, opts := range endpointOptions(opts, ociMetadataURL, ociMetadataIPv6URL) {
+		provider := NewOCIProvider(opts...)
 
-	// Try to get instance ID - if successful, we're on OCI
-	_, err := provider.GetInstanceID(ctx)
-	if err == nil {
-		return provider
+		// Try to get instance ID - if successful, we're on OCI
+		_, err := provider.GetInstanceID(ctx)
+		if err == nil {
+			return provider, nil
+		}
 	}
 
-	return nil
+	return nil, nil
 }
 
 func (p *OCIProvider) fetch(ctx context.Context, path string) (string, error) {
-	req, _ := http.NewRequestWithContext(ctx, "GET", p.baseURL+path, nil)
-
-	// OCI requires this header
-	req.Header.Set("Authorization", "Bearer Oracle")
-
-	resp, err := p.client.Do(req)
+	body, err := p.fetchRaw(ctx, path)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
-		return "", ErrNotFound
-	}
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
+	return strings.TrimSpace(string(body)), nil
+}
+
+// fetchRaw reads path without trimming the response
+func (p *OCIProvider) fetchRaw(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+path, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	body, _ := io.ReadAll(resp.Body)
-	return strings.TrimSpace(string(body)), nil
+	// OCI requires this header
+	req.Header.Set("Authorization", "Bearer Oracle")
+
+	return fetchBody(p.client, p.retry, p.Name(), path, req)
 }
 
 func (p *OCIProvider) GetInstanceID(ctx context.Context) (string, error) {
@@ -86,3 +91,235 @@ func (p *OCIProvider) GetHostname(ctx context.Context) (string, error) {
 func (p *OCIProvider) GetPrimaryIPv6(ctx context.Context) (string, error) {
 	return p.fetch(ctx, "/opc/v2/vnics/0/ipv6")
 }
+
+func (p *OCIProvider) GetRegion(ctx context.Context) (string, error) {
+	return p.fetch(ctx, "/opc/v2/instance/region")
+}
+
+// GetZone returns the availability domain
+func (p *OCIProvider) GetZone(ctx context.Context) (string, error) {
+	return p.fetch(ctx, "/opc/v2/instance/availabilityDomain")
+}
+
+// GetFaultDomain returns the fault domain within the availability domain
+func (p *OCIProvider) GetFaultDomain(ctx context.Context) (string, error) {
+	return p.fetch(ctx, "/opc/v2/instance/faultDomain")
+}
+
+// GetInstanceType returns the shape, e.g. VM.Standard.E4.Flex
+func (p *OCIProvider) GetInstanceType(ctx context.Context) (string, error) {
+	return p.fetch(ctx, "/opc/v2/instance/shape")
+}
+
+// GetImageID returns the OCID of the image the instance was launched from
+func (p *OCIProvider) GetImageID(ctx context.Context) (string, error) {
+	return p.fetch(ctx, "/opc/v2/instance/image")
+}
+
+// ociInstance holds the fields of the instance document used by the provider
+type ociInstance struct {
+	ID                 string                    `json:"id"`
+	Hostname           string                    `json:"hostname"`
+	Region             string                    `json:"region"`
+	AvailabilityDomain string                    `json:"availabilityDomain"`
+	Shape              string                    `json:"shape"`
+	Image              string                    `json:"image"`
+	TenantID           string                    `json:"tenantId"`
+	CompartmentID      string                    `json:"compartmentId"`
+	FreeformTags       map[string]string         `json:"freeformTags"`
+	DefinedTags        map[string]map[string]any `json:"definedTags"`
+	Metadata           struct {
+		SSHAuthorizedKeys string `json:"ssh_authorized_keys"`
+	} `json:"metadata"`
+}
+
+// instance reads and decodes the instance document
+func (p *OCIProvider) instance(ctx context.Context) (*ociInstance, error) {
+	const path = "/opc/v2/instance/"
+	body, err := p.fetch(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var instance ociInstance
+	if err := json.Unmarshal([]byte(body), &instance); err != nil {
+		return nil, fmt.Errorf("oci: decoding %s: %w", path, err)
+	}
+	return &instance, nil
+}
+
+// GetAccount returns the tenancy and compartment OCIDs
+func (p *OCIProvider) GetAccount(ctx context.Context) (*Account, error) {
+	instance, err := p.instance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return instance.account()
+}
+
+func (instance *ociInstance) account() (*Account, error) {
+	if instance.TenantID == "" && instance.CompartmentID == "" {
+		return nil, ErrNotFound
+	}
+
+	return &Account{
+		ID:            instance.TenantID,
+		CompartmentID: instance.CompartmentID,
+	}, nil
+}
+
+// GetTags returns the freeform tags and the defined tags, the latter keyed
+// as <namespace>.<key>
+func (p *OCIProvider) GetTags(ctx context.Context) (map[string]string, error) {
+	instance, err := p.instance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return instance.tags(), nil
+}
+
+func (instance *ociInstance) tags() map[string]string {
+	tags := make(map[string]string, len(instance.FreeformTags))
+	for k, v := range instance.FreeformTags {
+		tags[k] = v
+	}
+	for namespace, defined := range instance.DefinedTags {
+		for k, v := range defined {
+			tags[namespace+"."+k] = fmt.Sprint(v)
+		}
+	}
+	return tags
+}
+
+// GetUserData returns the user_data instance metadata key. It's stored
+// base64 encoded and decoded unless WithRawUserData is set.
+func (p *OCIProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	data, err := p.fetchRaw(ctx, "/opc/v2/instance/metadata/user_data")
+	if err != nil {
+		return nil, err
+	}
+	return decodeUserData(data, true, p.rawUserData)
+}
+
+// GetSSHKeys returns the keys in the ssh_authorized_keys instance metadata
+// key
+func (p *OCIProvider) GetSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	list, err := p.fetch(ctx, "/opc/v2/instance/metadata/ssh_authorized_keys")
+	if err != nil {
+		return nil, err
+	}
+	return ociSSHKeys(list)
+}
+
+func ociSSHKeys(list string) ([]SSHKey, error) {
+	var keys sshKeys
+	keys.addLines(list)
+	return keys.result()
+}
+
+// GetNetworkInterfaces returns the VNICs attached to the instance. The
+// metadata service doesn't expose the VCN or network security groups.
+func (p *OCIProvider) GetNetworkInterfaces(ctx context.Context) ([]NetworkInterface, error) {
+	const path = "/opc/v2/vnics/"
+	body, err := p.fetchRaw(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []struct {
+		VNICID          string   `json:"vnicId"`
+		MACAddr         string   `json:"macAddr"`
+		PrivateIP       string   `json:"privateIp"`
+		PublicIP        string   `json:"publicIp"`
+		IPv6Addresses   []string `json:"ipv6Addresses"`
+		SubnetCIDRBlock string   `json:"subnetCidrBlock"`
+		VirtualRouterIP string   `json:"virtualRouterIp"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("oci: decoding %s: %w", path, err)
+	}
+
+	nics := make([]NetworkInterface, 0, len(list))
+	for i, n := range list {
+		nics = append(nics, NetworkInterface{
+			ID:           n.VNICID,
+			MAC:          normalizeMAC(n.MACAddr),
+			DeviceIndex:  i,
+			PrivateIPv4s: appendNonEmpty(nil, n.PrivateIP),
+			PublicIPv4s:  appendNonEmpty(nil, n.PublicIP),
+			IPv6s:        n.IPv6Addresses,
+			SubnetCIDR:   n.SubnetCIDRBlock,
+			Gateway:      n.VirtualRouterIP,
+		})
+	}
+	return nics, nil
+}
+
+// GetIPv6Addresses returns the IPv6 addresses of every VNIC
+func (p *OCIProvider) GetIPv6Addresses(ctx context.Context) ([]string, error) {
+	return ipv6Addresses(ctx, p)
+}
+
+// GetIPv6Prefixes returns ErrNotFound, the metadata service doesn't expose VNIC prefixes
+func (p *OCIProvider) GetIPv6Prefixes(ctx context.Context) ([]string, error) {
+	return nil, ErrNotFound
+}
+
+func (p *OCIProvider) ipv6PrefixesFromInterfaces() bool {
+	return false
+}
+
+// ociDocument answers from the instance document, read with a single
+// request. Addresses are per VNIC and still fetched one by one.
+type ociDocument struct {
+	*OCIProvider
+	instance *ociInstance
+}
+
+func (p *OCIProvider) readDocument(ctx context.Context) (Provider, error) {
+	instance, err := p.instance(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &ociDocument{OCIProvider: p, instance: instance}, nil
+}
+
+func (d *ociDocument) GetInstanceID(ctx context.Context) (string, error) {
+	return nonEmpty(d.instance.ID, nil)
+}
+
+func (d *ociDocument) GetHostname(ctx context.Context) (string, error) {
+	return nonEmpty(d.instance.Hostname, nil)
+}
+
+func (d *ociDocument) GetIPv6Addresses(ctx context.Context) ([]string, error) {
+	return ipv6Addresses(ctx, d)
+}
+
+func (d *ociDocument) GetRegion(ctx context.Context) (string, error) {
+	return nonEmpty(d.instance.Region, nil)
+}
+
+func (d *ociDocument) GetZone(ctx context.Context) (string, error) {
+	return nonEmpty(d.instance.AvailabilityDomain, nil)
+}
+
+func (d *ociDocument) GetInstanceType(ctx context.Context) (string, error) {
+	return nonEmpty(d.instance.Shape, nil)
+}
+
+func (d *ociDocument) GetImageID(ctx context.Context) (string, error) {
+	return nonEmpty(d.instance.Image, nil)
+}
+
+func (d *ociDocument) GetAccount(ctx context.Context) (*Account, error) {
+	return d.instance.account()
+}
+
+func (d *ociDocument) GetTags(ctx context.Context) (map[string]string, error) {
+	return d.instance.tags(), nil
+}
+
+func (d *ociDocument) GetSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	return ociSSHKeys(d.instance.Metadata.SSHAuthorizedKeys)
+}
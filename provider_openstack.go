@@ -2,70 +2,98 @@ package cloudmeta
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"io"
+	"maps"
 	"net/http"
+	"slices"
 	"strings"
-	"time"
 )
 
 const openStackMetadataURL = "http://169.254.169.254"
 
 type OpenStackProvider struct {
-	baseURL string
-	client  *http.Client
+	baseURL     string
+	client      *http.Client
+	retry       RetryPolicy
+	rawUserData bool
 }
 
 func (p *OpenStackProvider) Name() string {
 	return "openstack"
 }
 
-func newOpenStackProvider(baseURL ...string) *OpenStackProvider {
-	url := openStackMetadataURL
-	if len(baseURL) > 0 && baseURL[0] != "" {
-		url = strings.TrimSuffix(baseURL[0], "/")
-	}
+// NewOpenStackProvider creates a provider for the OpenStack Nova metadata service
+func NewOpenStackProvider(opts ...Option) *OpenStackProvider {
+	cfg := newConfig(opts...)
 
 	return &OpenStackProvider{
-		client:  &http.Client{Timeout: 2 * time.Second},
-		baseURL: url,
+		client:      cfg.httpClient(),
+		retry:       cfg.retry,
+		rawUserData: cfg.rawUserData,
+		baseURL:     cfg.url(openStackMetadataURL, ""),
 	}
 }
 
-func detectOpenStack(ctx context.Context, baseURL ...string) Provider {
-	provider := newOpenStackProvider(baseURL...)
+func detectOpenStack(ctx context.Context, opts ...Option) (Provider, error) {
+	for _, opts := range endpointOptions(opts, openStackMetadataURL, "") {
+		provider := NewOpenStackProvider(opts...)
 
-	// Try OpenStack-specific endpoint - most reliable detection
-	if _, err := provider.fetch(ctx, "/openstack/latest/meta_data.json"); err == nil {
-		return provider
-	}
+		// Try OpenStack-specific endpoint - most reliable detection
+		if _, err := provider.fetch(ctx, "/openstack/latest/meta_data.json"); err == nil {
+			return provider, nil
+		}
 
-	// Fallback to instance-id
-	if _, err := provider.GetInstanceID(ctx); err == nil {
-		return provider
+		// Fallback to instance-id
+		if _, err := provider.GetInstanceID(ctx); err == nil {
+			return provider, nil
+		}
 	}
 
-	return nil
+	return nil, nil
 }
 
 func (p *OpenStackProvider) fetch(ctx context.Context, path string) (string, error) {
-	req, _ := http.NewRequestWithContext(ctx, "GET", p.baseURL+path, nil)
-
-	resp, err := p.client.Do(req)
+	body, err := p.fetchRaw(ctx, path)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
-		return "", ErrNotFound
+	return strings.TrimSpace(string(body)), nil
+}
+
+// fetchRaw reads path without trimming the response
+func (p *OpenStackProvider) fetchRaw(ctx context.Context, path string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.baseURL+path, nil)
+	if err != nil {
+		return nil, err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
+
+	return fetchBody(p.client, p.retry, p.Name(), path, req)
+}
+
+// openStackMetaData holds the fields of meta_data.json used by the provider
+type openStackMetaData struct {
+	UUID             string            `json:"uuid"`
+	Hostname         string            `json:"hostname"`
+	AvailabilityZone string            `json:"availability_zone"`
+	ProjectID        string            `json:"project_id"`
+	Meta             map[string]string `json:"meta"`
+	PublicKeys       map[string]string `json:"public_keys"`
+}
+
+// metaData reads and decodes meta_data.json
+func (p *OpenStackProvider) metaData(ctx context.Context) (*openStackMetaData, error) {
+	body, err := p.fetch(ctx, "/openstack/latest/meta_data.json")
+	if err != nil {
+		return nil, err
 	}
 
-	body, _ := io.ReadAll(resp.Body)
-	return strings.TrimSpace(string(body)), nil
+	var md openStackMetaData
+	if err := json.Unmarshal([]byte(body), &md); err != nil {
+		return nil, fmt.Errorf("openstack: decoding meta_data.json: %w", err)
+	}
+	return &md, nil
 }
 
 func (p *OpenStackProvider) GetInstanceID(ctx context.Context) (string, error) {
@@ -87,3 +115,205 @@ func (p *OpenStackProvider) GetHostname(ctx context.Context) (string, error) {
 func (p *OpenStackProvider) GetPrimaryIPv6(ctx context.Context) (string, error) {
 	return p.fetch(ctx, "/openstack/latest/meta_data/public-ipv6")
 }
+
+// GetRegion returns ErrNotFound, the metadata service doesn't expose regions
+func (p *OpenStackProvider) GetRegion(ctx context.Context) (string, error) {
+	return "", ErrNotFound
+}
+
+func (p *OpenStackProvider) GetZone(ctx context.Context) (string, error) {
+	md, err := p.metaData(ctx)
+	if err != nil {
+		return "", err
+	}
+	return nonEmpty(md.AvailabilityZone, nil)
+}
+
+// GetInstanceType returns ErrNotFound, the metadata service doesn't expose the flavor
+func (p *OpenStackProvider) GetInstanceType(ctx context.Context) (string, error) {
+	return "", ErrNotFound
+}
+
+// GetImageID returns ErrNotFound, the metadata service doesn't expose the image
+func (p *OpenStackProvider) GetImageID(ctx context.Context) (string, error) {
+	return "", ErrNotFound
+}
+
+// GetAccount returns the project ID
+func (p *OpenStackProvider) GetAccount(ctx context.Context) (*Account, error) {
+	md, err := p.metaData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return md.account()
+}
+
+func (md *openStackMetaData) account() (*Account, error) {
+	if md.ProjectID == "" {
+		return nil, ErrNotFound
+	}
+	return &Account{ID: md.ProjectID}, nil
+}
+
+// GetTags returns the instance metadata key/value pairs
+func (p *OpenStackProvider) GetTags(ctx context.Context) (map[string]string, error) {
+	md, err := p.metaData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return md.tags(), nil
+}
+
+func (md *openStackMetaData) tags() map[string]string {
+	if md.Meta == nil {
+		return make(map[string]string)
+	}
+	return md.Meta
+}
+
+func (p *OpenStackProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	data, err := p.fetchRaw(ctx, "/openstack/latest/user_data")
+	if err != nil {
+		return nil, err
+	}
+	return decodeUserData(data, false, p.rawUserData)
+}
+
+// GetSSHKeys returns the keypairs of the instance, in name order. Keys
+// without a comment are labelled with the keypair name.
+func (p *OpenStackProvider) GetSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	md, err := p.metaData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return md.sshKeys()
+}
+
+func (md *openStackMetaData) sshKeys() ([]SSHKey, error) {
+	var keys sshKeys
+	for _, name := range slices.Sorted(maps.Keys(md.PublicKeys)) {
+		keys.add(md.PublicKeys[name], "", name)
+	}
+	return keys.result()
+}
+
+// GetNetworkInterfaces returns the links of network_data.json with the
+// networks configured on them. Floating IPs and security groups aren't
+// exposed.
+func (p *OpenStackProvider) GetNetworkInterfaces(ctx context.Context) ([]NetworkInterface, error) {
+	const path = "/openstack/latest/network_data.json"
+	body, err := p.fetchRaw(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var nd struct {
+		Links []struct {
+			ID    string `json:"id"`
+			MAC   string `json:"ethernet_mac_address"`
+			VIFID string `json:"vif_id"`
+		} `json:"links"`
+		Networks []struct {
+			Type      string `json:"type"`
+			Link      string `json:"link"`
+			IPAddress string `json:"ip_address"`
+			Netmask   string `json:"netmask"`
+			NetworkID string `json:"network_id"`
+			Routes    []struct {
+				Network string `json:"network"`
+				Gateway string `json:"gateway"`
+			} `json:"routes"`
+		} `json:"networks"`
+	}
+	if err := json.Unmarshal(body, &nd); err != nil {
+		return nil, fmt.Errorf("openstack: decoding network_data.json: %w", err)
+	}
+
+	nics := make([]NetworkInterface, 0, len(nd.Links))
+	for i, link := range nd.Links {
+		nic := NetworkInterface{
+			ID:          link.VIFID,
+			MAC:         normalizeMAC(link.MAC),
+			DeviceIndex: i,
+		}
+		for _, n := range nd.Networks {
+			if n.Link != link.ID {
+				continue
+			}
+			if nic.NetworkID == "" {
+				nic.NetworkID = n.NetworkID
+			}
+
+			switch n.Type {
+			case "ipv4":
+				nic.PrivateIPv4s = appendNonEmpty(nic.PrivateIPv4s, n.IPAddress)
+				if nic.SubnetCIDR == "" {
+					nic.SubnetCIDR = subnetCIDR(n.IPAddress, n.Netmask)
+				}
+				for _, r := range n.Routes {
+					if r.Network == "0.0.0.0" && nic.Gateway == "" {
+						nic.Gateway = r.Gateway
+					}
+				}
+			case "ipv6":
+				nic.IPv6s = appendNonEmpty(nic.IPv6s, n.IPAddress)
+			}
+		}
+		nics = append(nics, nic)
+	}
+	return nics, nil
+}
+
+// GetIPv6Addresses returns the IPv6 addresses of every link in
+// network_data.json
+func (p *OpenStackProvider) GetIPv6Addresses(ctx context.Context) ([]string, error) {
+	return ipv6Addresses(ctx, p)
+}
+
+// GetIPv6Prefixes returns ErrNotFound, Nova doesn't expose delegated prefixes
+func (p *OpenStackProvider) GetIPv6Prefixes(ctx context.Context) ([]string, error) {
+	return nil, ErrNotFound
+}
+
+func (p *OpenStackProvider) ipv6PrefixesFromInterfaces() bool {
+	return false
+}
+
+// openStackDocument answers from meta_data.json, read with a single
+// request. Addresses aren't part of it and are still fetched one by one.
+type openStackDocument struct {
+	*OpenStackProvider
+	md *openStackMetaData
+}
+
+func (p *OpenStackProvider) readDocument(ctx context.Context) (Provider, error) {
+	md, err := p.metaData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &openStackDocument{OpenStackProvider: p, md: md}, nil
+}
+
+func (d *openStackDocument) GetInstanceID(ctx context.Context) (string, error) {
+	return nonEmpty(d.md.UUID, nil)
+}
+
+func (d *openStackDocument) GetHostname(ctx context.Context) (string, error) {
+	return nonEmpty(d.md.Hostname, nil)
+}
+
+func (d *openStackDocument) GetZone(ctx context.Context) (string, error) {
+	return nonEmpty(d.md.AvailabilityZone, nil)
+}
+
+func (d *openStackDocument) GetAccount(ctx context.Context) (*Account, error) {
+	return d.md.account()
+}
+
+func (d *openStackDocument) GetTags(ctx context.Context) (map[string]string, error) {
+	return d.md.tags(), nil
+}
+
+func (d *openStackDocument) GetSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	return d.md.sshKeys()
+}
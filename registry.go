@@ -0,0 +1,134 @@
+package cloudmeta
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+)
+
+// DetectFunc recognizes a single platform. It returns a nil Provider and a
+// nil error when the host isn't running on that platform, and a non-nil
+// error when the platform was recognized but can't be used. The options
+// the Detector was created with are passed on so the provider can honour
+// them.
+type DetectFunc func(ctx context.Context, opts ...Option) (Provider, error)
+
+// Registration describes a registered provider
+type Registration struct {
+	Name     string
+	Priority int
+}
+
+type registration struct {
+	Registration
+	detect  DetectFunc
+	builtin bool // detect is the built-in one for Name
+}
+
+// constructors create the built-in providers without probing them
+var constructors = map[string]func(opts ...Option) Provider{
+	"aws":          func(opts ...Option) Provider { return NewAWSProvider(opts...) },
+	"gcp":          func(opts ...Option) Provider { return NewGCPProvider(opts...) },
+	"azure":        func(opts ...Option) Provider { return NewAzureProvider(opts...) },
+	"oci":          func(opts ...Option) Provider { return NewOCIProvider(opts...) },
+	"hetzner":      func(opts ...Option) Provider { return NewHetznerProvider(opts...) },
+	"openstack":    func(opts ...Option) Provider { return NewOpenStackProvider(opts...) },
+	"digitalocean": func(opts ...Option) Provider { return NewDigitalOceanProvider(opts...) },
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []registration
+)
+
+func init() {
+	register("aws", detectAWS, 100, true)
+	register("gcp", detectGCP, 200, true)
+	register("azure", detectAzure, 300, true)
+	register("oci", detectOCI, 400, true)
+	register("hetzner", detectHetzner, 500, true)
+	register("openstack", detectOpenStack, 600, true)
+	register("digitalocean", detectDigitalOcean, 700, true)
+}
+
+// Register adds a provider to auto-detection. Providers with a lower
+// priority win when several detect the host; the built-in ones use
+// multiples of 100, starting with 100 for aws. Registering an existing name
+// replaces it, also when that provider is forced.
+func Register(name string, detect DetectFunc, priority int) {
+	register(name, detect, priority, false)
+}
+
+func register(name string, detect DetectFunc, priority int, builtin bool) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	registry = slices.DeleteFunc(registry, func(r registration) bool {
+		return r.Name == name
+	})
+	registry = append(registry, registration{
+		Registration: Registration{Name: name, Priority: priority},
+		detect:       detect,
+		builtin:      builtin,
+	})
+	sortRegistry()
+}
+
+// Unregister removes a provider from auto-detection. It reports whether the
+// provider was registered.
+func Unregister(name string) bool {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	n := len(registry)
+	registry = slices.DeleteFunc(registry, func(r registration) bool {
+		return r.Name == name
+	})
+	return len(registry) != n
+}
+
+// SetPriority changes the priority of a registered provider. It reports
+// whether the provider was registered.
+func SetPriority(name string, priority int) bool {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	i := slices.IndexFunc(registry, func(r registration) bool {
+		return r.Name == name
+	})
+	if i < 0 {
+		return false
+	}
+	registry[i].Priority = priority
+	sortRegistry()
+	return true
+}
+
+// Registered lists the registered providers in detection order
+func Registered() []Registration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	list := make([]Registration, len(registry))
+	for i, r := range registry {
+		list[i] = r.Registration
+	}
+	return list
+}
+
+// registered returns a snapshot of the registry in detection order
+func registered() []registration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	return slices.Clone(registry)
+}
+
+// sortRegistry orders the registry by priority. Registration order breaks
+// ties. The caller must hold registryMu.
+func sortRegistry() {
+	slices.SortStableFunc(registry, func(a, b registration) int {
+		return cmp.Compare(a.Priority, b.Priority)
+	})
+}
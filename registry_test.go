@@ -0,0 +1,89 @@
+package cloudmeta
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+// bareMetalProvider stands in for a provider registered by another package
+type bareMetalProvider struct {
+	OpenStackProvider
+}
+
+func (p *bareMetalProvider) Name() string {
+	return "baremetal"
+}
+
+func detectBareMetal(ctx context.Context, opts ...Option) (Provider, error) {
+	return &bareMetalProvider{}, nil
+}
+
+func registeredNames() []string {
+	var names []string
+	for _, r := range Registered() {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+func TestRegistered(t *testing.T) {
+	want := []string{"aws", "gcp", "azure", "oci", "hetzner", "openstack", "digitalocean"}
+	if got := registeredNames(); !slices.Equal(got, want) {
+		t.Errorf("Registered() = %v, want %v", got, want)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("baremetal", detectBareMetal, 550)
+	defer Unregister("baremetal")
+
+	names := registeredNames()
+	if i := slices.Index(names, "baremetal"); i < 0 || names[i+1] != "openstack" {
+		t.Fatalf("Expected baremetal right before openstack, got %v", names)
+	}
+
+	detector := NewDetector(WithDMIRoot(""), WithProviders("baremetal", "openstack"))
+	provider, err := detector.Detect(context.TODO())
+	if err != nil {
+		t.Fatalf("Failed to detect provider: %v", err)
+	}
+	if provider.Name() != "baremetal" {
+		t.Fatalf("Expected provider 'baremetal', got '%s'", provider.Name())
+	}
+
+	if !Unregister("baremetal") {
+		t.Fatal("Expected baremetal to be registered")
+	}
+	if slices.Contains(registeredNames(), "baremetal") {
+		t.Fatal("Expected baremetal to be removed")
+	}
+}
+
+func TestRegisterReplacesForced(t *testing.T) {
+	Register("openstack", detectBareMetal, 600)
+	defer register("openstack", detectOpenStack, 600, true)
+
+	provider, err := NewDetector(WithDMIRoot(""), WithForcedProvider("openstack")).Detect(context.TODO())
+	if err != nil {
+		t.Fatalf("Failed to get provider: %v", err)
+	}
+	if provider.Name() != "baremetal" {
+		t.Fatalf("Expected the replacement provider, got '%s'", provider.Name())
+	}
+}
+
+func TestSetPriority(t *testing.T) {
+	if !SetPriority("digitalocean", 50) {
+		t.Fatal("Expected digitalocean to be registered")
+	}
+	defer SetPriority("digitalocean", 700)
+
+	if got := registeredNames()[0]; got != "digitalocean" {
+		t.Errorf("Expected digitalocean first, got %s", got)
+	}
+
+	if SetPriority("unknown", 1) {
+		t.Error("Expected SetPriority to fail for an unknown provider")
+	}
+}
@@ -0,0 +1,236 @@
+package cloudmeta
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Confidence rates how certain a detection decision is
+type Confidence int
+
+const (
+	// ConfidenceNone means no provider was detected
+	ConfidenceNone Confidence = iota
+	// ConfidenceMedium means the provider's metadata service answered, but
+	// nothing else confirmed the platform
+	ConfidenceMedium
+	// ConfidenceHigh means the metadata service answered and another signal,
+	// such as DMI or a provider specific header, confirmed the platform. It
+	// is also used when the provider was forced.
+	ConfidenceHigh
+)
+
+func (c Confidence) String() string {
+	switch c {
+	case ConfidenceMedium:
+		return "medium"
+	case ConfidenceHigh:
+		return "high"
+	}
+	return "none"
+}
+
+// signalHeaders are response headers that identify a provider's metadata
+// service
+var signalHeaders = []struct {
+	provider, header, value string
+}{
+	{"aws", "Server", "EC2ws"},
+	{"gcp", "Metadata-Flavor", "Google"},
+}
+
+// Request describes a single metadata request made while probing
+type Request struct {
+	Method     string
+	URL        string
+	StatusCode int // zero if no response was received
+	Err        error
+	Latency    time.Duration
+}
+
+// Candidate describes how a registered provider was probed
+type Candidate struct {
+	Name     string
+	Priority int
+	Probed   bool
+	Detected bool
+	Err      error // error returned by the provider's DetectFunc
+	Latency  time.Duration
+	Requests []Request
+	Signals  []string // e.g. "dmi", "imdsv2-token", "Metadata-Flavor: Google"
+}
+
+// Report explains a detection decision
+type Report struct {
+	Provider   Provider // nil if no provider was detected
+	Err        error
+	Confidence Confidence
+	Forced     bool   // the provider was forced through an option or the environment
+	DMI        string // provider the DMI fields point to, if any
+	Candidates []Candidate
+}
+
+// DetectReport runs detection with the default settings and explains the
+// decision. It always probes and never uses or updates the cache of
+// GetProvider.
+func DetectReport(ctx context.Context) *Report {
+	return defaultDetector.Report(ctx)
+}
+
+// Report runs detection and explains the decision. It always probes and
+// never uses or updates the Detector's cache.
+func (d *Detector) Report(ctx context.Context) *Report {
+	rep := &Report{}
+	rep.Provider, rep.Err = d.detect(ctx, newConfig(d.opts...), rep)
+	rep.Confidence = rep.confidence()
+	return rep
+}
+
+func (r *Report) confidence() Confidence {
+	if r.Provider == nil {
+		return ConfidenceNone
+	}
+	if r.Forced {
+		return ConfidenceHigh
+	}
+
+	for _, c := range r.Candidates {
+		if c.Detected && c.Name == r.Provider.Name() && len(c.Signals) > 0 {
+			return ConfidenceHigh
+		}
+	}
+	return ConfidenceMedium
+}
+
+// String formats the report for operators
+func (r *Report) String() string {
+	var b strings.Builder
+
+	switch {
+	case r.Provider != nil:
+		fmt.Fprintf(&b, "provider: %s (confidence %s)\n", r.Provider.Name(), r.Confidence)
+	case r.Err != nil:
+		fmt.Fprintf(&b, "provider: none (%v)\n", r.Err)
+	}
+	if r.Forced {
+		b.WriteString("forced: yes\n")
+	}
+	if r.DMI != "" {
+		fmt.Fprintf(&b, "dmi: %s\n", r.DMI)
+	}
+
+	for _, c := range r.Candidates {
+		if !c.Probed {
+			fmt.Fprintf(&b, "- %s: not probed\n", c.Name)
+			continue
+		}
+		fmt.Fprintf(&b, "- %s: detected=%t latency=%s", c.Name, c.Detected, c.Latency.Round(time.Millisecond))
+		if len(c.Signals) > 0 {
+			fmt.Fprintf(&b, " signals=[%s]", strings.Join(c.Signals, ", "))
+		}
+		if c.Err != nil {
+			fmt.Fprintf(&b, " error=%q", c.Err)
+		}
+		b.WriteString("\n")
+		for _, req := range c.Requests {
+			fmt.Fprintf(&b, "    %s %s: ", req.Method, req.URL)
+			if req.Err != nil {
+				fmt.Fprintf(&b, "%v", req.Err)
+			} else {
+				fmt.Fprintf(&b, "HTTP %d", req.StatusCode)
+			}
+			fmt.Fprintf(&b, " (%s)\n", req.Latency.Round(time.Millisecond))
+		}
+	}
+
+	return b.String()
+}
+
+// record wraps detect so that its outcome and requests are stored in c.
+// The caller must add one to wg for every call made to the returned func.
+func (c *Candidate) record(detect DetectFunc, wg *sync.WaitGroup) DetectFunc {
+	return func(ctx context.Context, opts ...Option) (Provider, error) {
+		defer wg.Done()
+
+		rec := &recorder{name: c.Name}
+		ctx = context.WithValue(ctx, recorderKey{}, rec)
+
+		start := time.Now()
+		p, err := detect(ctx, opts...)
+
+		c.Probed = true
+		c.Detected = p != nil
+		c.Err = err
+		c.Latency = time.Since(start)
+
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		c.Requests = rec.requests
+		c.Signals = append(c.Signals, rec.signals...)
+
+		return p, err
+	}
+}
+
+type recorderKey struct{}
+
+// recorder collects the requests and signals of a single probe
+type recorder struct {
+	name     string
+	mu       sync.Mutex
+	requests []Request
+	signals  []string
+}
+
+// recordSignal notes a signal that identifies the platform being probed
+func recordSignal(ctx context.Context, signal string) {
+	rec, ok := ctx.Value(recorderKey{}).(*recorder)
+	if !ok {
+		return
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if slices.Contains(rec.signals, signal) {
+		return
+	}
+	rec.signals = append(rec.signals, signal)
+}
+
+// doRequest sends req, recording it when it's part of a detection report
+func doRequest(client *http.Client, req *http.Request) (*http.Response, error) {
+	rec, ok := req.Context().Value(recorderKey{}).(*recorder)
+	if !ok {
+		return client.Do(req)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+
+	r := Request{
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Err:     err,
+		Latency: time.Since(start),
+	}
+	if resp != nil {
+		r.StatusCode = resp.StatusCode
+		for _, h := range signalHeaders {
+			if h.provider == rec.name && resp.Header.Get(h.header) == h.value {
+				recordSignal(req.Context(), h.header+": "+h.value)
+			}
+		}
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.requests = append(rec.requests, r)
+
+	return resp, err
+}
@@ -0,0 +1,81 @@
+package cloudmeta
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/nickgarlis/go-cloudmeta/internal/test"
+)
+
+func TestDetectorReport(t *testing.T) {
+	mockServer := test.CreateMockGCPServer()
+	defer mockServer.Close()
+
+	detector := NewDetector(WithBaseURL(mockServer.URL), WithDMIRoot(""), WithProviders("aws", "gcp"))
+	rep := detector.Report(context.TODO())
+
+	if rep.Err != nil {
+		t.Fatalf("Unexpected error: %v", rep.Err)
+	}
+	if rep.Provider == nil || rep.Provider.Name() != "gcp" {
+		t.Fatalf("Expected provider 'gcp', got %v", rep.Provider)
+	}
+	if rep.Confidence != ConfidenceHigh {
+		t.Errorf("Expected confidence high, got %s", rep.Confidence)
+	}
+
+	for _, c := range rep.Candidates {
+		switch c.Name {
+		case "aws":
+			if !c.Probed || c.Detected {
+				t.Errorf("Expected aws to be probed and rejected, got %+v", c)
+			}
+			if len(c.Requests) == 0 || c.Requests[0].StatusCode != 403 {
+				t.Errorf("Expected aws token request to get HTTP 403, got %+v", c.Requests)
+			}
+		case "gcp":
+			if !c.Probed || !c.Detected {
+				t.Errorf("Expected gcp to be detected, got %+v", c)
+			}
+			if !slices.Contains(c.Signals, "Metadata-Flavor: Google") {
+				t.Errorf("Expected Metadata-Flavor signal, got %v", c.Signals)
+			}
+		default:
+			if c.Probed {
+				t.Errorf("Expected %s not to be probed", c.Name)
+			}
+		}
+	}
+
+	if _, err := detector.Detect(context.TODO()); err != nil {
+		t.Fatalf("Failed to detect provider: %v", err)
+	}
+}
+
+func TestDetectorReportAWSToken(t *testing.T) {
+	mockServer := test.CreateMockAWSServer()
+	defer mockServer.Close()
+
+	rep := NewDetector(WithBaseURL(mockServer.URL), WithDMIRoot(""), WithProviders("aws")).Report(context.TODO())
+	if rep.Provider == nil || rep.Provider.Name() != "aws" {
+		t.Fatalf("Expected provider 'aws', got %v", rep.Provider)
+	}
+
+	signals := rep.Candidates[0].Signals
+	for _, want := range []string{"imdsv2-token", "Server: EC2ws"} {
+		if !slices.Contains(signals, want) {
+			t.Errorf("Expected signal %q, got %v", want, signals)
+		}
+	}
+}
+
+func TestDetectorReportNone(t *testing.T) {
+	rep := NewDetector(WithForcedProvider("none")).Report(context.TODO())
+	if rep.Provider != nil || rep.Confidence != ConfidenceNone {
+		t.Fatalf("Expected no provider, got %v with confidence %s", rep.Provider, rep.Confidence)
+	}
+	if !rep.Forced {
+		t.Error("Expected report to be marked as forced")
+	}
+}
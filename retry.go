@@ -0,0 +1,122 @@
+package cloudmeta
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how failed metadata reads are retried. Only GET
+// requests are retried, and only after a network error or an HTTP 429, 500,
+// 502, 503 or 504 response.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// Values below two disable retries.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry. It doubles with every
+	// further attempt and is jittered.
+	BaseDelay time.Duration
+	// MaxDelay caps every delay, including those asked for by Retry-After
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used unless WithRetry says otherwise
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+}
+
+// WithRetry sets the retry policy of metadata reads. Use a zero
+// RetryPolicy to disable retries.
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *config) {
+		c.retry = policy
+	}
+}
+
+type probeKey struct{}
+
+// withProbe marks ctx as belonging to a detection probe. Probes aren't
+// retried so that hosts without a metadata service fail fast.
+func withProbe(ctx context.Context) context.Context {
+	return context.WithValue(ctx, probeKey{}, true)
+}
+
+func isProbe(ctx context.Context) bool {
+	probe, _ := ctx.Value(probeKey{}).(bool)
+	return probe
+}
+
+// attempts returns how many times req may be sent
+func (rp RetryPolicy) attempts(req *http.Request) int {
+	if req.Method != http.MethodGet || isProbe(req.Context()) {
+		return 1
+	}
+	return max(rp.MaxAttempts, 1)
+}
+
+// delay returns how long to wait before retrying after the given attempt.
+// A positive retryAfter, taken from the response, replaces the backoff.
+func (rp RetryPolicy) delay(attempt int, retryAfter time.Duration) time.Duration {
+	d := retryAfter
+	if d <= 0 {
+		d = rp.backoff(attempt)
+		if d > 0 {
+			// Jitter between half and the full backoff
+			d = d/2 + rand.N(d/2+1)
+		}
+	}
+	if rp.MaxDelay > 0 && d > rp.MaxDelay {
+		d = rp.MaxDelay
+	}
+	return d
+}
+
+// backoff returns BaseDelay doubled for every attempt after the first. The
+// doubling stops once even the jittered delay reaches MaxDelay, or before
+// it would overflow.
+func (rp RetryPolicy) backoff(attempt int) time.Duration {
+	d := rp.BaseDelay
+	for range attempt - 1 {
+		if rp.MaxDelay > 0 && d/2 >= rp.MaxDelay || d > math.MaxInt64/2 {
+			break
+		}
+		d *= 2
+	}
+	return d
+}
+
+// retryable reports whether a failed request may succeed when sent again
+func retryable(ctx context.Context, err *MetadataError) bool {
+	switch err.StatusCode {
+	case 0:
+		// Network error, unless the caller gave up
+		return ctx.Err() == nil
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an
+// HTTP date. It returns zero if the header is missing or invalid.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,136 @@
+package cloudmeta
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer fails the first failures requests with status
+func flakyServer(failures int32, status int, header http.Header) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("4242"))
+	}))
+	return server, &calls
+}
+
+func TestRetryTransientErrors(t *testing.T) {
+	server, calls := flakyServer(2, http.StatusServiceUnavailable, nil)
+	defer server.Close()
+
+	provider := NewHetznerProvider(
+		WithBaseURL(server.URL),
+		WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}),
+	)
+
+	id, err := provider.GetInstanceID(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if id != "4242" {
+		t.Errorf("Expected instance ID 4242, got %s", id)
+	}
+	if got := calls.Load(); got != 3 {
+		t.Errorf("Expected 3 attempts, got %d", got)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	server, calls := flakyServer(5, http.StatusTooManyRequests, nil)
+	defer server.Close()
+
+	provider := NewHetznerProvider(
+		WithBaseURL(server.URL),
+		WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}),
+	)
+
+	_, err := provider.GetInstanceID(context.Background())
+	if !errors.Is(err, ErrThrottled) {
+		t.Fatalf("Expected ErrThrottled, got %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("Expected 2 attempts, got %d", got)
+	}
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	server, calls := flakyServer(1, http.StatusNotFound, nil)
+	defer server.Close()
+
+	provider := NewHetznerProvider(WithBaseURL(server.URL))
+
+	if _, err := provider.GetInstanceID(context.Background()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Expected 1 attempt, got %d", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	header := http.Header{"Retry-After": []string{"1"}}
+	server, _ := flakyServer(1, http.StatusTooManyRequests, header)
+	defer server.Close()
+
+	provider := NewHetznerProvider(
+		WithBaseURL(server.URL),
+		WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: 3 * time.Second}),
+	)
+
+	start := time.Now()
+	if _, err := provider.GetInstanceID(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expected Retry-After to be honoured, retried after %s", elapsed)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond} {
+		if got := policy.delay(attempt, 0); got < want/2 || got > want {
+			t.Errorf("delay(%d) = %s, want between %s and %s", attempt, got, want/2, want)
+		}
+	}
+
+	if got := policy.delay(5, 0); got != policy.MaxDelay {
+		t.Errorf("Expected delay to be capped at %s, got %s", policy.MaxDelay, got)
+	}
+	// The backoff would overflow without the cap
+	if got := policy.delay(100, 0); got != policy.MaxDelay {
+		t.Errorf("Expected delay to be capped at %s, got %s", policy.MaxDelay, got)
+	}
+	if got := (RetryPolicy{BaseDelay: time.Second}).delay(100, 0); got <= 0 {
+		t.Errorf("Expected a positive delay without MaxDelay, got %s", got)
+	}
+	if got := policy.delay(1, time.Minute); got != policy.MaxDelay {
+		t.Errorf("Expected Retry-After to be capped at %s, got %s", policy.MaxDelay, got)
+	}
+}
+
+func TestRetrySkippedForProbes(t *testing.T) {
+	server, calls := flakyServer(1, http.StatusServiceUnavailable, nil)
+	defer server.Close()
+
+	detector := NewDetector(WithBaseURL(server.URL), WithDMIRoot(""), WithProviders("hetzner"))
+	if _, err := detector.Detect(context.Background()); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("Expected ErrUnknownProvider, got %v", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("Expected probe not to be retried, got %d attempts", got)
+	}
+}
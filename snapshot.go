@@ -0,0 +1,219 @@
+package cloudmeta
+
+import (
+	"context"
+	"sync"
+)
+
+// Metadata is a snapshot of the instance metadata. Fields that couldn't be
+// read are left empty, with the reason recorded in Errors.
+//
+// User data isn't included; it can be large and tends to hold secrets.
+// Read it with GetUserData.
+//
+// Metadata encodes to JSON with the field names of its json tags, and
+// loads back from it. YAML and Env encode it for non-Go consumers.
+type Metadata struct {
+	Provider          string             `json:"provider"`
+	InstanceID        string             `json:"instance_id,omitempty"`
+	Hostname          string             `json:"hostname,omitempty"`
+	PrivateIPv4       string             `json:"private_ipv4,omitempty"`
+	PublicIPv4        string             `json:"public_ipv4,omitempty"`
+	PrimaryIPv6       string             `json:"primary_ipv6,omitempty"`
+	IPv6Addresses     []string           `json:"ipv6_addresses,omitempty"`
+	IPv6Prefixes      []string           `json:"ipv6_prefixes,omitempty"`
+	Region            string             `json:"region,omitempty"`
+	Zone              string             `json:"zone,omitempty"`
+	InstanceType      string             `json:"instance_type,omitempty"`
+	ImageID           string             `json:"image_id,omitempty"`
+	Account           *Account           `json:"account,omitempty"`
+	Tags              map[string]string  `json:"tags,omitempty"`
+	SSHKeys           []SSHKey           `json:"ssh_keys,omitempty"`
+	NetworkInterfaces []NetworkInterface `json:"network_interfaces,omitempty"`
+
+	// Errors maps the names of the fields that couldn't be read, e.g.
+	// PublicIPv4, to the error encountered
+	Errors map[string]error `json:"-"`
+}
+
+// snapshotField reads one field of Metadata through the Provider interface
+type snapshotField struct {
+	name string
+	// key names the field in the JSON, YAML and env encodings
+	key string
+	get func(ctx context.Context, p Provider, m *Metadata) error
+}
+
+var snapshotFields = []snapshotField{
+	{"InstanceID", "instance_id", func(ctx context.Context, p Provider, m *Metadata) (err error) {
+		m.InstanceID, err = p.GetInstanceID(ctx)
+		return err
+	}},
+	{"Hostname", "hostname", func(ctx context.Context, p Provider, m *Metadata) (err error) {
+		m.Hostname, err = p.GetHostname(ctx)
+		return err
+	}},
+	{"PrivateIPv4", "private_ipv4", func(ctx context.Context, p Provider, m *Metadata) (err error) {
+		m.PrivateIPv4, err = nonEmpty(p.GetPrivateIPv4(ctx))
+		return err
+	}},
+	{"PublicIPv4", "public_ipv4", func(ctx context.Context, p Provider, m *Metadata) (err error) {
+		m.PublicIPv4, err = nonEmpty(p.GetPublicIPv4(ctx))
+		return err
+	}},
+	{"PrimaryIPv6", "primary_ipv6", func(ctx context.Context, p Provider, m *Metadata) (err error) {
+		m.PrimaryIPv6, err = nonEmpty(p.GetPrimaryIPv6(ctx))
+		return err
+	}},
+	{"IPv6Addresses", "ipv6_addresses", func(ctx context.Context, p Provider, m *Metadata) error {
+		return read(p, &m.IPv6Addresses, func(e IPv6Provider) ([]string, error) { return e.GetIPv6Addresses(ctx) })
+	}},
+	{"IPv6Prefixes", "ipv6_prefixes", func(ctx context.Context, p Provider, m *Metadata) error {
+		return read(p, &m.IPv6Prefixes, func(e IPv6Provider) ([]string, error) { return e.GetIPv6Prefixes(ctx) })
+	}},
+	{"Region", "region", func(ctx context.Context, p Provider, m *Metadata) error {
+		return read(p, &m.Region, func(e PlacementProvider) (string, error) { return e.GetRegion(ctx) })
+	}},
+	{"Zone", "zone", func(ctx context.Context, p Provider, m *Metadata) error {
+		return read(p, &m.Zone, func(e PlacementProvider) (string, error) { return e.GetZone(ctx) })
+	}},
+	{"InstanceType", "instance_type", func(ctx context.Context, p Provider, m *Metadata) error {
+		return read(p, &m.InstanceType, func(e MachineProvider) (string, error) { return e.GetInstanceType(ctx) })
+	}},
+	{"ImageID", "image_id", func(ctx context.Context, p Provider, m *Metadata) error {
+		return read(p, &m.ImageID, func(e MachineProvider) (string, error) { return e.GetImageID(ctx) })
+	}},
+	{"Account", "account", func(ctx context.Context, p Provider, m *Metadata) error {
+		return read(p, &m.Account, func(e AccountProvider) (*Account, error) { return e.GetAccount(ctx) })
+	}},
+	{"Tags", "tags", func(ctx context.Context, p Provider, m *Metadata) error {
+		return read(p, &m.Tags, func(e TagsProvider) (map[string]string, error) { return e.GetTags(ctx) })
+	}},
+	{"SSHKeys", "ssh_keys", func(ctx context.Context, p Provider, m *Metadata) error {
+		return read(p, &m.SSHKeys, func(e SSHKeysProvider) ([]SSHKey, error) { return e.GetSSHKeys(ctx) })
+	}},
+	{"NetworkInterfaces", "network_interfaces", func(ctx context.Context, p Provider, m *Metadata) error {
+		return read(p, &m.NetworkInterfaces, func(e NetworkInterfacesProvider) ([]NetworkInterface, error) { return e.GetNetworkInterfaces(ctx) })
+	}},
+}
+
+// read stores the value get reads through the optional interface T in dst
+func read[T, V any](p Provider, dst *V, get func(T) (V, error)) error {
+	ext, err := extension[T](p)
+	if err != nil {
+		return err
+	}
+	*dst, err = get(ext)
+	return err
+}
+
+// interfacesIPv6 is implemented by providers whose GetIPv6Addresses reads
+// GetNetworkInterfaces. Snapshot derives that field from the interfaces it
+// reads anyway, rather than listing them again. ipv6PrefixesFromInterfaces
+// reports whether GetIPv6Prefixes reads them too and is derived the same
+// way; when it returns false, Snapshot calls GetIPv6Prefixes itself.
+type interfacesIPv6 interface {
+	ipv6PrefixesFromInterfaces() bool
+}
+
+// interfaceFields derive the fields of Metadata that interfacesIPv6
+// providers read from the network interfaces
+var interfaceFields = map[string]func(m *Metadata, nics []NetworkInterface) error{
+	"IPv6Addresses": func(m *Metadata, nics []NetworkInterface) (err error) {
+		m.IPv6Addresses, err = interfaceValues(nics, func(nic NetworkInterface) []string { return nic.IPv6s })
+		return err
+	},
+	"IPv6Prefixes": func(m *Metadata, nics []NetworkInterface) (err error) {
+		m.IPv6Prefixes, err = interfaceValues(nics, func(nic NetworkInterface) []string { return nic.IPv6Prefixes })
+		return err
+	},
+}
+
+// derivedFields returns the fields Snapshot derives from the network
+// interfaces of p instead of reading them
+func derivedFields(p Provider) map[string]bool {
+	d, ok := p.(interfacesIPv6)
+	if !ok {
+		return nil
+	}
+	return map[string]bool{"IPv6Addresses": true, "IPv6Prefixes": d.ipv6PrefixesFromInterfaces()}
+}
+
+// documentReader is implemented by providers that can serve their metadata
+// as a single document. readDocument reads it and returns a Provider that
+// answers from the document where it can.
+type documentReader interface {
+	readDocument(ctx context.Context) (Provider, error)
+}
+
+// Snapshot reads all metadata of the instance concurrently. A field that
+// can't be read doesn't fail the snapshot; its error is recorded in
+// Metadata.Errors. Only when no field could be read is an error, the one
+// for InstanceID, returned.
+//
+// Providers that serve their metadata as one document are asked for it
+// first, leaving fewer fields to fetch one by one. The network interfaces
+// are listed once, and IPv6 fields derived from them where the provider
+// would read them from the interfaces too.
+func Snapshot(ctx context.Context, p Provider) (*Metadata, error) {
+	m := &Metadata{
+		Provider: p.Name(),
+		Errors:   make(map[string]error),
+	}
+
+	if r, ok := p.(documentReader); ok {
+		// If the document can't be read, each field is fetched on its own
+		if doc, err := r.readDocument(ctx); err == nil {
+			p = doc
+		}
+	}
+
+	derived := derivedFields(p)
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, f := range snapshotFields {
+		if derived[f.name] {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := f.get(ctx, p, m); err != nil {
+				mu.Lock()
+				m.Errors[f.name] = err
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for name, ok := range derived {
+		if !ok {
+			continue
+		}
+		err := m.Errors["NetworkInterfaces"]
+		if err == nil {
+			err = interfaceFields[name](m, m.NetworkInterfaces)
+		}
+		if err != nil {
+			m.Errors[name] = err
+		}
+	}
+
+	if len(m.Errors) == len(snapshotFields) {
+		return nil, m.Errors["InstanceID"]
+	}
+	return m, nil
+}
+
+// first returns the first of values, or ErrNotFound if there are none
+func first(values []string) (string, error) {
+	if len(values) == 0 {
+		return "", ErrNotFound
+	}
+	return values[0], nil
+}
@@ -0,0 +1,215 @@
+package cloudmeta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/nickgarlis/go-cloudmeta/internal/test"
+)
+
+// countRequests wraps the server's handler to count the requests for path,
+// or all requests if path is empty
+func countRequests(server *httptest.Server, path string) *atomic.Int32 {
+	var count atomic.Int32
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if path == "" || r.URL.Path == path {
+			count.Add(1)
+		}
+		handler.ServeHTTP(w, r)
+	})
+	return &count
+}
+
+// fieldByField builds the snapshot one getter at a time, to compare
+// Snapshot against
+func fieldByField(t *testing.T, p Provider) *Metadata {
+	t.Helper()
+
+	m := &Metadata{Provider: p.Name(), Errors: make(map[string]error)}
+	for _, f := range snapshotFields {
+		if err := f.get(context.Background(), p, m); err != nil {
+			m.Errors[f.name] = err
+		}
+	}
+	return m
+}
+
+func compareSnapshot(t *testing.T, got, want *Metadata) {
+	t.Helper()
+
+	gotErrors, wantErrors := got.Errors, want.Errors
+	got.Errors, want.Errors = nil, nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Snapshot() = %+v, want %+v", got, want)
+	}
+
+	for name, err := range wantErrors {
+		if gotErrors[name] == nil {
+			t.Errorf("Snapshot() Errors[%s] = nil, want %v", name, err)
+		} else if errors.Is(err, ErrNotFound) != errors.Is(gotErrors[name], ErrNotFound) {
+			t.Errorf("Snapshot() Errors[%s] = %v, want %v", name, gotErrors[name], err)
+		}
+	}
+	for name, err := range gotErrors {
+		if wantErrors[name] == nil {
+			t.Errorf("Snapshot() Errors[%s] = %v, want none", name, err)
+		}
+	}
+}
+
+func TestSnapshot_AWS(t *testing.T) {
+	server := test.CreateMockAWSServer()
+	defer server.Close()
+
+	// An instance without a public address
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/meta-data/public-ipv4" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+	listings := countRequests(server, "/latest/meta-data/network/interfaces/macs/")
+
+	provider := NewAWSProvider(WithBaseURL(server.URL))
+	m, err := Snapshot(context.Background(), provider)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if got := listings.Load(); got != 1 {
+		t.Errorf("Snapshot() listed the ENIs %d times, want 1", got)
+	}
+
+	if m.Provider != "aws" || m.InstanceID != "i-1234567890abcdef0" || m.Region != "us-west-2" {
+		t.Errorf("Snapshot() = %+v", m)
+	}
+	if !errors.Is(m.Errors["PublicIPv4"], ErrNotFound) {
+		t.Errorf("Snapshot() Errors[PublicIPv4] = %v, want ErrNotFound", m.Errors["PublicIPv4"])
+	}
+	compareSnapshot(t, m, fieldByField(t, provider))
+}
+
+func TestSnapshot_Document(t *testing.T) {
+	server := test.CreateMockGCPServer()
+	defer server.Close()
+	requests := countRequests(server, "")
+
+	provider := NewGCPProvider(WithBaseURL(server.URL))
+	m, err := Snapshot(context.Background(), provider)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("Snapshot() made %d requests, want 1", got)
+	}
+
+	if m.InstanceID != "1234567890123456789" || m.Zone != "us-central1-a" || len(m.SSHKeys) != 2 {
+		t.Errorf("Snapshot() = %+v", m)
+	}
+	compareSnapshot(t, m, fieldByField(t, provider))
+}
+
+func TestSnapshot_DocumentTags(t *testing.T) {
+	server := test.CreateMockGCPServer()
+	defer server.Close()
+
+	m, err := Snapshot(context.Background(), NewGCPProvider(WithBaseURL(server.URL)))
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if want := map[string]string{"role": "web"}; !reflect.DeepEqual(m.Tags, want) {
+		t.Errorf("Snapshot() Tags = %v, want %v", m.Tags, want)
+	}
+
+	env, err := m.Env()
+	if err != nil {
+		t.Fatalf("Env() error = %v", err)
+	}
+	for _, name := range []string{"CLOUD_TAGS_SSH_KEYS=", "CLOUD_TAGS_ENABLE_OSLOGIN="} {
+		if strings.Contains(string(env), name) {
+			t.Errorf("Env() = %s, has %s", env, name)
+		}
+	}
+}
+
+func TestSnapshot_DocumentUnavailable(t *testing.T) {
+	server := test.CreateMockGCPServer()
+	defer server.Close()
+
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/computeMetadata/v1/" {
+			w.Header().Set("Metadata-Flavor", "Google")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+
+	provider := NewGCPProvider(WithBaseURL(server.URL))
+	m, err := Snapshot(context.Background(), provider)
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	compareSnapshot(t, m, fieldByField(t, provider))
+}
+
+func TestSnapshot_Unavailable(t *testing.T) {
+	server := test.CreateMockGCPServer(true)
+	defer server.Close()
+
+	provider := NewGCPProvider(WithBaseURL(server.URL), WithRetry(RetryPolicy{}))
+	m, err := Snapshot(context.Background(), provider)
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Snapshot() error = %v, want ErrUnavailable", err)
+	}
+	if m != nil {
+		t.Errorf("Snapshot() = %+v, want nil", m)
+	}
+}
+
+// minimalProvider only implements the Provider interface
+type minimalProvider struct{}
+
+func (minimalProvider) Name() string { return "minimal" }
+func (minimalProvider) GetInstanceID(ctx context.Context) (string, error) {
+	return "i-minimal", nil
+}
+func (minimalProvider) GetHostname(ctx context.Context) (string, error)    { return "", ErrNotFound }
+func (minimalProvider) GetPrivateIPv4(ctx context.Context) (string, error) { return "10.0.0.1", nil }
+func (minimalProvider) GetPublicIPv4(ctx context.Context) (string, error)  { return "", ErrNotFound }
+func (minimalProvider) GetPrimaryIPv6(ctx context.Context) (string, error) { return "", ErrNotFound }
+
+func TestSnapshot_OptionalInterfaces(t *testing.T) {
+	m, err := Snapshot(context.Background(), minimalProvider{})
+	if err != nil {
+		t.Fatalf("Snapshot() error = %v", err)
+	}
+	if m.InstanceID != "i-minimal" || m.PrivateIPv4 != "10.0.0.1" {
+		t.Errorf("Snapshot() = %+v", m)
+	}
+	if !errors.Is(m.Errors["Region"], ErrNotSupported) || !errors.Is(m.Errors["Tags"], ErrNotSupported) {
+		t.Errorf("Snapshot() Errors = %v, want ErrNotSupported for optional fields", m.Errors)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var loaded Metadata
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if !errors.Is(loaded.Errors["Region"], ErrNotSupported) {
+		t.Errorf("loaded Errors[Region] = %v, want ErrNotSupported", loaded.Errors["Region"])
+	}
+}
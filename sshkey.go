@@ -0,0 +1,123 @@
+package cloudmeta
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SSHKey is an SSH public key the platform provisioned for the instance
+type SSHKey struct {
+	// Type is the key algorithm, e.g. ssh-ed25519
+	Type string `json:"type"`
+	// Key is the base64 encoded key material
+	Key     string `json:"key"`
+	Comment string `json:"comment,omitempty"`
+	// User is the account the key is meant for, if the provider says
+	User string `json:"user,omitempty"`
+}
+
+// String returns the key as an authorized_keys line
+func (k SSHKey) String() string {
+	if k.Comment == "" {
+		return k.Type + " " + k.Key
+	}
+	return k.Type + " " + k.Key + " " + k.Comment
+}
+
+// SSHKeyError reports a key entry that couldn't be parsed. It unwraps to
+// ErrMalformedSSHKey.
+type SSHKeyError struct {
+	Entry  string
+	Reason string
+}
+
+func (e *SSHKeyError) Error() string {
+	entry := e.Entry
+	if len(entry) > 64 {
+		entry = entry[:64] + "..."
+	}
+	return fmt.Sprintf("%s: %s: %q", ErrMalformedSSHKey, e.Reason, entry)
+}
+
+func (e *SSHKeyError) Unwrap() error {
+	return ErrMalformedSSHKey
+}
+
+// parseSSHKey parses an authorized_keys style "type key [comment]" entry.
+// The key material has to decode and name the same algorithm as the
+// entry.
+func parseSSHKey(entry string) (SSHKey, error) {
+	fields := strings.Fields(entry)
+	if len(fields) < 2 {
+		return SSHKey{}, &SSHKeyError{Entry: entry, Reason: "missing key material"}
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return SSHKey{}, &SSHKeyError{Entry: entry, Reason: "key material isn't base64"}
+	}
+
+	// The blob starts with the algorithm name as an SSH string
+	if len(blob) < 4 || uint32(len(blob)-4) < binary.BigEndian.Uint32(blob) {
+		return SSHKey{}, &SSHKeyError{Entry: entry, Reason: "truncated key material"}
+	}
+	algorithm := string(blob[4 : 4+binary.BigEndian.Uint32(blob)])
+	if algorithm != fields[0] {
+		return SSHKey{}, &SSHKeyError{Entry: entry, Reason: fmt.Sprintf("%s key labelled %s", algorithm, fields[0])}
+	}
+
+	return SSHKey{
+		Type:    fields[0],
+		Key:     fields[1],
+		Comment: strings.Join(fields[2:], " "),
+	}, nil
+}
+
+// sshKeys collects the keys of a provider, keeping track of malformed
+// entries
+type sshKeys struct {
+	keys []SSHKey
+	errs []error
+}
+
+// add parses entry. name replaces a missing comment.
+func (s *sshKeys) add(entry, user, name string) {
+	key, err := parseSSHKey(entry)
+	if err != nil {
+		s.errs = append(s.errs, err)
+		return
+	}
+
+	key.User = user
+	if key.Comment == "" {
+		key.Comment = name
+	}
+	s.keys = append(s.keys, key)
+}
+
+// addLines adds one key per line, skipping blank lines and comments
+func (s *sshKeys) addLines(text string) {
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		s.add(line, "", "")
+	}
+}
+
+func (s *sshKeys) fail(entry, reason string) {
+	s.errs = append(s.errs, &SSHKeyError{Entry: entry, Reason: reason})
+}
+
+// result returns the valid keys, along with an error joining those of the
+// malformed entries. No entries at all is ErrNotFound.
+func (s *sshKeys) result() ([]SSHKey, error) {
+	if len(s.keys) == 0 && len(s.errs) == 0 {
+		return nil, ErrNotFound
+	}
+	return s.keys, errors.Join(s.errs...)
+}
@@ -0,0 +1,72 @@
+package cloudmeta
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+const testSSHKey = "AAAAC3NzaC1lZDI1NTE5AAAAIAABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4f"
+
+func TestParseSSHKey(t *testing.T) {
+	key, err := parseSSHKey("ssh-ed25519 " + testSSHKey + " alice@laptop (work)")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := SSHKey{Type: "ssh-ed25519", Key: testSSHKey, Comment: "alice@laptop (work)"}
+	if key != want {
+		t.Errorf("Expected %+v, got %+v", want, key)
+	}
+	if got := key.String(); got != "ssh-ed25519 "+testSSHKey+" alice@laptop (work)" {
+		t.Errorf("Unexpected authorized_keys line %q", got)
+	}
+}
+
+func TestParseSSHKey_Malformed(t *testing.T) {
+	tests := map[string]string{
+		"empty":             "",
+		"no key material":   "ssh-ed25519",
+		"not base64":        "ssh-ed25519 not-base64!",
+		"truncated":         "ssh-ed25519 AAAAC3NzaC1l",
+		"algorithm differs": "ssh-rsa " + testSSHKey,
+		"options":           `no-pty ssh-ed25519 ` + testSSHKey,
+	}
+
+	for name, entry := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseSSHKey(entry)
+			if !errors.Is(err, ErrMalformedSSHKey) {
+				t.Errorf("Expected ErrMalformedSSHKey, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAddGCPKeys(t *testing.T) {
+	var keys sshKeys
+	addGCPKeys(&keys, "alice:ssh-ed25519 "+testSSHKey+" alice@laptop\n\nssh-ed25519 "+testSSHKey+"\nbob:ssh-ed25519 broken\n")
+
+	got, err := keys.result()
+	want := []SSHKey{{Type: "ssh-ed25519", Key: testSSHKey, Comment: "alice@laptop", User: "alice"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected keys %+v, got %+v", want, got)
+	}
+
+	var keyErr *SSHKeyError
+	if !errors.As(err, &keyErr) || !errors.Is(err, ErrMalformedSSHKey) {
+		t.Fatalf("Expected SSHKeyError, got %v", err)
+	}
+	if n := len(err.(interface{ Unwrap() []error }).Unwrap()); n != 2 {
+		t.Errorf("Expected 2 malformed entries, got %d", n)
+	}
+}
+
+func TestSSHKeys_Empty(t *testing.T) {
+	var keys sshKeys
+	keys.addLines("\n# no keys\n")
+
+	if got, err := keys.result(); got != nil || !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v, %v", got, err)
+	}
+}
@@ -0,0 +1,99 @@
+package cloudmeta
+
+import "context"
+
+// StaticProvider serves a Metadata snapshot instead of querying a metadata
+// service, e.g. one saved as JSON on the instance for offline use. Fields
+// that failed when the snapshot was taken return the recorded error, and
+// fields that are empty return ErrNotFound.
+type StaticProvider struct {
+	m *Metadata
+}
+
+// NewStaticProvider creates a provider answering from m
+func NewStaticProvider(m *Metadata) *StaticProvider {
+	return &StaticProvider{m: m}
+}
+
+// Name returns the name of the provider the snapshot was taken on
+func (p *StaticProvider) Name() string {
+	return p.m.Provider
+}
+
+// staticField returns value, unless the snapshot recorded an error for the
+// field or the value is missing
+func staticField[T any](p *StaticProvider, name string, value T, present bool) (T, error) {
+	var zero T
+	if err := p.m.Errors[name]; err != nil {
+		return zero, err
+	}
+	if !present {
+		return zero, ErrNotFound
+	}
+	return value, nil
+}
+
+func (p *StaticProvider) GetInstanceID(ctx context.Context) (string, error) {
+	return staticField(p, "InstanceID", p.m.InstanceID, p.m.InstanceID != "")
+}
+
+func (p *StaticProvider) GetHostname(ctx context.Context) (string, error) {
+	return staticField(p, "Hostname", p.m.Hostname, p.m.Hostname != "")
+}
+
+func (p *StaticProvider) GetPrivateIPv4(ctx context.Context) (string, error) {
+	return staticField(p, "PrivateIPv4", p.m.PrivateIPv4, p.m.PrivateIPv4 != "")
+}
+
+func (p *StaticProvider) GetPublicIPv4(ctx context.Context) (string, error) {
+	return staticField(p, "PublicIPv4", p.m.PublicIPv4, p.m.PublicIPv4 != "")
+}
+
+func (p *StaticProvider) GetPrimaryIPv6(ctx context.Context) (string, error) {
+	return staticField(p, "PrimaryIPv6", p.m.PrimaryIPv6, p.m.PrimaryIPv6 != "")
+}
+
+func (p *StaticProvider) GetIPv6Addresses(ctx context.Context) ([]string, error) {
+	return staticField(p, "IPv6Addresses", p.m.IPv6Addresses, len(p.m.IPv6Addresses) > 0)
+}
+
+func (p *StaticProvider) GetIPv6Prefixes(ctx context.Context) ([]string, error) {
+	return staticField(p, "IPv6Prefixes", p.m.IPv6Prefixes, len(p.m.IPv6Prefixes) > 0)
+}
+
+func (p *StaticProvider) GetRegion(ctx context.Context) (string, error) {
+	return staticField(p, "Region", p.m.Region, p.m.Region != "")
+}
+
+func (p *StaticProvider) GetZone(ctx context.Context) (string, error) {
+	return staticField(p, "Zone", p.m.Zone, p.m.Zone != "")
+}
+
+func (p *StaticProvider) GetInstanceType(ctx context.Context) (string, error) {
+	return staticField(p, "InstanceType", p.m.InstanceType, p.m.InstanceType != "")
+}
+
+func (p *StaticProvider) GetImageID(ctx context.Context) (string, error) {
+	return staticField(p, "ImageID", p.m.ImageID, p.m.ImageID != "")
+}
+
+func (p *StaticProvider) GetAccount(ctx context.Context) (*Account, error) {
+	return staticField(p, "Account", p.m.Account, p.m.Account != nil)
+}
+
+func (p *StaticProvider) GetTags(ctx context.Context) (map[string]string, error) {
+	return staticField(p, "Tags", p.m.Tags, p.m.Tags != nil)
+}
+
+// GetUserData returns ErrNotFound, snapshots don't include user data
+func (p *StaticProvider) GetUserData(ctx context.Context) ([]byte, error) {
+	return nil, ErrNotFound
+}
+
+func (p *StaticProvider) GetSSHKeys(ctx context.Context) ([]SSHKey, error) {
+	return staticField(p, "SSHKeys", p.m.SSHKeys, len(p.m.SSHKeys) > 0)
+}
+
+func (p *StaticProvider) GetNetworkInterfaces(ctx context.Context) ([]NetworkInterface, error) {
+	return staticField(p, "NetworkInterfaces", p.m.NetworkInterfaces, len(p.m.NetworkInterfaces) > 0)
+}
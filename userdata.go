@@ -0,0 +1,46 @@
+package cloudmeta
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/nickgarlis/go-cloudmeta/internal/gunzip"
+)
+
+// MaxUserDataSize caps the size of decompressed user data. Providers accept
+// at most a few hundred kilobytes of user data, so anything larger is a
+// decompression bomb rather than a real payload.
+const MaxUserDataSize = 16 << 20
+
+// decodeUserData undoes the encodings applied to user data. encoded is set
+// for providers that always serve user data base64 encoded. Gzip
+// compressed payloads are detected by their magic number and decompressed,
+// failing if they expand past MaxUserDataSize. Empty user data is reported
+// as ErrNotFound.
+func decodeUserData(data []byte, encoded, raw bool) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, ErrNotFound
+	}
+	if raw {
+		return data, nil
+	}
+
+	if encoded {
+		decoded := make([]byte, base64.StdEncoding.DecodedLen(len(data)))
+		n, err := base64.StdEncoding.Decode(decoded, bytes.TrimSpace(data))
+		if err != nil {
+			return nil, fmt.Errorf("decoding base64 user data: %w", err)
+		}
+		data = decoded[:n]
+	}
+
+	if gunzip.Is(data) {
+		decompressed, err := gunzip.Bytes(data, MaxUserDataSize)
+		if err != nil {
+			return nil, fmt.Errorf("decompressing user data: %w", err)
+		}
+		data = decompressed
+	}
+	return data, nil
+}
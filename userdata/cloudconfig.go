@@ -0,0 +1,141 @@
+package userdata
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// CloudConfig is the merge of one or more #cloud-config documents. It's
+// kept as YAML text split by top-level key, so a section can be decoded
+// with whichever YAML library the caller already uses.
+type CloudConfig struct {
+	keys     []string
+	sections map[string][]byte
+}
+
+// MergeCloudConfig merges the #cloud-config parts, in order. As with
+// cloud-init's default merge, a top-level key set by a later document
+// replaces the value from an earlier one; the values themselves aren't
+// merged and merge_how directives aren't interpreted. Parts of other
+// types are skipped.
+func MergeCloudConfig(parts []Part) (*CloudConfig, error) {
+	cfg := &CloudConfig{sections: make(map[string][]byte)}
+	for _, p := range parts {
+		if p.ContentType != TypeCloudConfig {
+			continue
+		}
+		if err := cfg.merge(p.Body); err != nil {
+			if p.Filename != "" {
+				return nil, fmt.Errorf("userdata: %s: %w", p.Filename, err)
+			}
+			return nil, fmt.Errorf("userdata: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// ParseCloudConfig reads a single #cloud-config part, which may hold
+// several YAML documents separated by ---
+func ParseCloudConfig(data []byte) (*CloudConfig, error) {
+	return MergeCloudConfig([]Part{{ContentType: TypeCloudConfig, Body: data}})
+}
+
+// Keys returns the top-level keys in the order they first appeared
+func (c *CloudConfig) Keys() []string {
+	return append([]string(nil), c.keys...)
+}
+
+// Section returns the YAML for key, including the key itself, e.g.
+// "runcmd:\n  - echo hello\n"
+func (c *CloudConfig) Section(key string) ([]byte, bool) {
+	section, ok := c.sections[key]
+	if !ok {
+		return nil, false
+	}
+	return bytes.Clone(section), true
+}
+
+// Bytes returns the merged configuration as a #cloud-config document
+func (c *CloudConfig) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("#cloud-config\n")
+	for _, key := range c.keys {
+		buf.Write(c.sections[key])
+	}
+	return buf.Bytes()
+}
+
+// merge splits a YAML block mapping into its top-level entries. Comments
+// and blank lines outside values are dropped.
+func (c *CloudConfig) merge(data []byte) error {
+	var (
+		key     string
+		section []byte
+	)
+	flush := func() {
+		if key == "" {
+			return
+		}
+		// Blank lines belong to the value only if more of it follows
+		section = append(bytes.TrimRight(section, " \t\r\n"), '\n')
+		if _, ok := c.sections[key]; !ok {
+			c.keys = append(c.keys, key)
+		}
+		c.sections[key] = section
+		key, section = "", nil
+	}
+
+	for i, line := range strings.SplitAfter(string(data), "\n") {
+		trimmed := strings.TrimRight(line, " \t\r\n")
+		switch {
+		case trimmed == "" || line[0] == ' ' || line[0] == '\t' || line[0] == '-' && trimmed != "---":
+			// Part of the current value, a sequence may start at column 0
+			if key == "" {
+				if trimmed != "" && !strings.HasPrefix(strings.TrimSpace(trimmed), "#") {
+					return fmt.Errorf("line %d: value outside of a mapping key", i+1)
+				}
+				continue
+			}
+			section = append(section, line...)
+		case line[0] == '#':
+			continue
+		case trimmed == "---" || trimmed == "...":
+			flush()
+		default:
+			name, err := mappingKey(trimmed)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", i+1, err)
+			}
+			flush()
+			key = name
+			section = append(section, strings.TrimRight(line, "\r\n")+"\n"...)
+		}
+	}
+	flush()
+	return nil
+}
+
+// mappingKey returns the key of a top-level "key: value" line
+func mappingKey(line string) (string, error) {
+	if q := line[0]; q == '"' || q == '\'' {
+		end := strings.IndexByte(line[1:], q)
+		if end < 0 || !strings.HasPrefix(line[end+2:], ":") {
+			return "", fmt.Errorf("malformed quoted key %s", line)
+		}
+		return line[1 : end+1], nil
+	}
+
+	if strings.HasPrefix(line, "{") || strings.HasPrefix(line, "[") {
+		return "", fmt.Errorf("flow style documents aren't supported")
+	}
+
+	if key, ok := strings.CutSuffix(line, ":"); ok && !strings.Contains(key, ": ") {
+		return key, nil
+	}
+	key, _, ok := strings.Cut(line, ": ")
+	if !ok {
+		return "", fmt.Errorf("expected a mapping key, got %q", line)
+	}
+	return key, nil
+}
@@ -0,0 +1,87 @@
+package userdata
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeCloudConfig(t *testing.T) {
+	parts := []Part{
+		{ContentType: TypeCloudConfig, Body: []byte(`#cloud-config
+hostname: web-1
+packages:
+  - nginx
+
+  - curl
+runcmd:
+- echo first
+# trailing comment
+`)},
+		{ContentType: TypeShellScript, Body: []byte("#!/bin/sh\nhostname: ignored\n")},
+		{ContentType: TypeCloudConfig, Body: []byte(`#cloud-config
+runcmd:
+  - echo second
+---
+"my-agent":
+  endpoint: https://example.com
+  token: |
+    abc
+
+    def
+...
+`)},
+	}
+
+	cfg, err := MergeCloudConfig(parts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	wantKeys := []string{"hostname", "packages", "runcmd", "my-agent"}
+	if keys := cfg.Keys(); !reflect.DeepEqual(keys, wantKeys) {
+		t.Errorf("Expected keys %v, got %v", wantKeys, keys)
+	}
+
+	sections := map[string]string{
+		"hostname": "hostname: web-1\n",
+		"packages": "packages:\n  - nginx\n\n  - curl\n",
+		"runcmd":   "runcmd:\n  - echo second\n",
+		"my-agent": "\"my-agent\":\n  endpoint: https://example.com\n  token: |\n    abc\n\n    def\n",
+	}
+	for key, want := range sections {
+		got, ok := cfg.Section(key)
+		if !ok {
+			t.Errorf("Section(%q) not found", key)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("Section(%q) = %q, want %q", key, got, want)
+		}
+	}
+
+	if _, ok := cfg.Section("users"); ok {
+		t.Error("Expected no users section")
+	}
+
+	want := "#cloud-config\n" + sections["hostname"] + sections["packages"] + sections["runcmd"] + sections["my-agent"]
+	if got := string(cfg.Bytes()); got != want {
+		t.Errorf("Bytes() = %q, want %q", got, want)
+	}
+}
+
+func TestParseCloudConfig_Errors(t *testing.T) {
+	tests := map[string]string{
+		"flow style":   "#cloud-config\n{hostname: web-1}\n",
+		"scalar":       "#cloud-config\njust text\n",
+		"orphan value": "#cloud-config\n  indented: true\n",
+		"unterminated": "#cloud-config\n\"hostname: web-1\n",
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseCloudConfig([]byte(data)); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+// Package userdata splits cloud-init user data into its parts and merges
+// the #cloud-config documents among them, without depending on cloud-init.
+package userdata
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+
+	"github.com/nickgarlis/go-cloudmeta"
+	"github.com/nickgarlis/go-cloudmeta/internal/gunzip"
+)
+
+// Content types of the parts cloud-init understands
+const (
+	TypeCloudConfig  = "text/cloud-config"
+	TypeArchive      = "text/cloud-config-archive"
+	TypeShellScript  = "text/x-shellscript"
+	TypeInclude      = "text/x-include-url"
+	TypeIncludeOnce  = "text/x-include-once-url"
+	TypeBoothook     = "text/cloud-boothook"
+	TypePartHandler  = "text/part-handler"
+	TypeJinja        = "text/jinja2"
+	TypePlain        = "text/plain"
+	TypeNotMultipart = "text/x-not-multipart"
+	TypeGzip         = "application/x-gzip"
+	TypeMultipart    = "multipart/mixed"
+)
+
+// maxDepth bounds the nesting of multipart and gzip parts
+const maxDepth = 8
+
+// prefixes maps the first line of a part to its content type, longest
+// prefix first so #include-once isn't taken for #include, nor
+// #cloud-config-archive for #cloud-config
+var prefixes = []struct {
+	prefix      string
+	contentType string
+}{
+	{"#include-once", TypeIncludeOnce},
+	{"#include", TypeInclude},
+	{"#cloud-config-archive", TypeArchive},
+	{"#cloud-config", TypeCloudConfig},
+	{"#cloud-boothook", TypeBoothook},
+	{"#part-handler", TypePartHandler},
+	{"## template: jinja", TypeJinja},
+	{"#!", TypeShellScript},
+}
+
+// Part is a single piece of user data
+type Part struct {
+	// ContentType is the declared MIME type, or the type implied by the
+	// first line for parts declared as plain text
+	ContentType string
+	// Filename is taken from the part's Content-Disposition, if any
+	Filename string
+	// Body is the part content with transfer encodings and gzip
+	// compression removed
+	Body []byte
+}
+
+// Load reads the user data of the instance and parses it. The provider has
+// to implement cloudmeta.UserDataProvider.
+func Load(ctx context.Context, p cloudmeta.Provider) ([]Part, error) {
+	up, ok := p.(cloudmeta.UserDataProvider)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", p.Name(), cloudmeta.ErrNotSupported)
+	}
+
+	data, err := up.GetUserData(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse splits user data into its parts. Multipart archives, including
+// nested ones, are flattened in order, and gzip compressed payloads are
+// decompressed and parsed in turn. Anything else yields a single part.
+func Parse(data []byte) ([]Part, error) {
+	return parse(data, "", 0)
+}
+
+func parse(data []byte, filename string, depth int) ([]Part, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("userdata: parts nested deeper than %d levels", maxDepth)
+	}
+
+	if gunzip.Is(data) {
+		decompressed, err := gunzip.Bytes(data, cloudmeta.MaxUserDataSize)
+		if err != nil {
+			return nil, fmt.Errorf("userdata: decompressing: %w", err)
+		}
+		return parse(decompressed, filename, depth+1)
+	}
+
+	if isMIME(data) {
+		return parseMIME(data, depth)
+	}
+
+	return []Part{{
+		ContentType: detect(data),
+		Filename:    filename,
+		Body:        data,
+	}}, nil
+}
+
+// isMIME reports whether data starts with a MIME header
+func isMIME(data []byte) bool {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	name, _, ok := strings.Cut(string(line), ":")
+	if !ok {
+		return false
+	}
+	name = strings.ToLower(name)
+	return name == "content-type" || name == "mime-version"
+}
+
+// parseMIME parses a MIME message, which cloud-init archives are
+func parseMIME(data []byte, depth int) ([]Part, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("userdata: reading MIME header: %w", err)
+	}
+
+	body, err := io.ReadAll(msg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("userdata: reading MIME body: %w", err)
+	}
+	return parseEntity(msg.Header, body, depth)
+}
+
+// header is implemented by the headers of messages and of their parts
+type header interface {
+	Get(key string) string
+}
+
+// parseEntity decodes a MIME entity with header h and parses its content
+func parseEntity(h header, body []byte, depth int) ([]Part, error) {
+	contentType := TypePlain
+	var params map[string]string
+	if v := h.Get("Content-Type"); v != "" {
+		var err error
+		if contentType, params, err = mime.ParseMediaType(v); err != nil {
+			return nil, fmt.Errorf("userdata: parsing content type %q: %w", v, err)
+		}
+	}
+
+	body, err := decodeTransfer(h.Get("Content-Transfer-Encoding"), body)
+	if err != nil {
+		return nil, err
+	}
+
+	filename := params["name"]
+	if v := h.Get("Content-Disposition"); v != "" {
+		if _, dparams, err := mime.ParseMediaType(v); err == nil && dparams["filename"] != "" {
+			filename = dparams["filename"]
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(contentType, "multipart/"):
+		return parseMultipart(body, params["boundary"], depth+1)
+	case contentType == TypeGzip || contentType == "application/gzip" || gunzip.Is(body):
+		return parse(body, filename, depth+1)
+	case contentType == TypePlain || contentType == TypeNotMultipart:
+		contentType = detect(body)
+	}
+
+	return []Part{{
+		ContentType: contentType,
+		Filename:    filename,
+		Body:        body,
+	}}, nil
+}
+
+func parseMultipart(body []byte, boundary string, depth int) ([]Part, error) {
+	if boundary == "" {
+		return nil, fmt.Errorf("userdata: multipart payload without boundary")
+	}
+	if depth > maxDepth {
+		return nil, fmt.Errorf("userdata: parts nested deeper than %d levels", maxDepth)
+	}
+
+	var parts []Part
+	r := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		p, err := r.NextRawPart()
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("userdata: reading multipart payload: %w", err)
+		}
+
+		content, err := io.ReadAll(p)
+		if err != nil {
+			return nil, fmt.Errorf("userdata: reading part: %w", err)
+		}
+
+		sub, err := parseEntity(p.Header, content, depth)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, sub...)
+	}
+}
+
+// decodeTransfer removes a Content-Transfer-Encoding. Quoted-printable
+// isn't used by cloud-init tools and is left alone, like 7bit and 8bit.
+func decodeTransfer(encoding string, body []byte) ([]byte, error) {
+	if !strings.EqualFold(strings.TrimSpace(encoding), "base64") {
+		return body, nil
+	}
+
+	// Encoded bodies are wrapped at 76 columns
+	clean := bytes.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' || r == ' ' || r == '\t' {
+			return -1
+		}
+		return r
+	}, body)
+
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(len(clean)))
+	n, err := base64.StdEncoding.Decode(decoded, clean)
+	if err != nil {
+		return nil, fmt.Errorf("userdata: decoding base64 part: %w", err)
+	}
+	return decoded[:n], nil
+}
+
+// detect returns the content type implied by the first line of body
+func detect(body []byte) string {
+	line, _, _ := bytes.Cut(body, []byte("\n"))
+	for _, p := range prefixes {
+		if bytes.HasPrefix(line, []byte(p.prefix)) {
+			return p.contentType
+		}
+	}
+	return TypePlain
+}
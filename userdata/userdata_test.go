@@ -0,0 +1,158 @@
+package userdata
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nickgarlis/go-cloudmeta"
+	"github.com/nickgarlis/go-cloudmeta/internal/test"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// archive builds a cloud-init style MIME multipart archive
+func archive(parts ...string) string {
+	var b strings.Builder
+	b.WriteString("Content-Type: multipart/mixed; boundary=\"BOUNDARY\"\nMIME-Version: 1.0\n\n")
+	for _, p := range parts {
+		b.WriteString("--BOUNDARY\n")
+		b.WriteString(p)
+		b.WriteString("\n")
+	}
+	b.WriteString("--BOUNDARY--\n")
+	return b.String()
+}
+
+func TestParse_Single(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "cloud-config", data: "#cloud-config\npackages: [nginx]\n", want: TypeCloudConfig},
+		{name: "archive", data: "#cloud-config-archive\n- type: text/x-shellscript\n", want: TypeArchive},
+		{name: "script", data: "#!/bin/bash\necho hi\n", want: TypeShellScript},
+		{name: "include", data: "#include\nhttps://example.com/a\n", want: TypeInclude},
+		{name: "include once", data: "#include-once\nhttps://example.com/a\n", want: TypeIncludeOnce},
+		{name: "boothook", data: "#cloud-boothook\necho boot\n", want: TypeBoothook},
+		{name: "plain", data: "hello", want: TypePlain},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := Parse([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(parts) != 1 {
+				t.Fatalf("Expected 1 part, got %d", len(parts))
+			}
+			if parts[0].ContentType != tt.want {
+				t.Errorf("Expected content type %s, got %s", tt.want, parts[0].ContentType)
+			}
+			if string(parts[0].Body) != tt.data {
+				t.Errorf("Expected body %q, got %q", tt.data, parts[0].Body)
+			}
+		})
+	}
+}
+
+func TestParse_Gzip(t *testing.T) {
+	parts, err := Parse(gzipped(t, "#!/bin/sh\necho hi\n"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []Part{{ContentType: TypeShellScript, Body: []byte("#!/bin/sh\necho hi\n")}}
+	if !reflect.DeepEqual(parts, want) {
+		t.Errorf("Expected %+v, got %+v", want, parts)
+	}
+}
+
+func TestParse_Multipart(t *testing.T) {
+	script := base64.StdEncoding.EncodeToString([]byte("#!/bin/sh\necho hi\n"))
+	compressed := base64.StdEncoding.EncodeToString(gzipped(t, "#cloud-config\nhostname: web-1\n"))
+	nested := strings.ReplaceAll(archive(
+		"Content-Type: text/x-include-url\n\nhttps://example.com/extra",
+	), "BOUNDARY", "NESTED")
+
+	data := archive(
+		"Content-Type: text/cloud-config; charset=\"us-ascii\"\nContent-Disposition: attachment; filename=\"config.yaml\"\n\n#cloud-config\npackages:\n  - nginx",
+		"Content-Type: text/x-shellscript\nContent-Transfer-Encoding: base64\nContent-Disposition: attachment; filename=\"setup.sh\"\n\n"+script,
+		"Content-Type: application/x-gzip\nContent-Transfer-Encoding: base64\n\n"+compressed,
+		"Content-Type: text/x-not-multipart\n\n#cloud-boothook\necho boot",
+		"Content-Type: multipart/mixed; boundary=\"NESTED\"\n\n"+strings.SplitN(nested, "\n\n", 2)[1],
+	)
+
+	parts, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	want := []Part{
+		{ContentType: TypeCloudConfig, Filename: "config.yaml", Body: []byte("#cloud-config\npackages:\n  - nginx")},
+		{ContentType: TypeShellScript, Filename: "setup.sh", Body: []byte("#!/bin/sh\necho hi\n")},
+		{ContentType: TypeCloudConfig, Body: []byte("#cloud-config\nhostname: web-1\n")},
+		{ContentType: TypeBoothook, Body: []byte("#cloud-boothook\necho boot")},
+		{ContentType: TypeInclude, Body: []byte("https://example.com/extra")},
+	}
+	if !reflect.DeepEqual(parts, want) {
+		t.Errorf("Expected\n%+v\ngot\n%+v", want, parts)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := map[string]string{
+		"missing boundary": "Content-Type: multipart/mixed\n\nbody",
+		"bad base64":       archive("Content-Type: text/x-shellscript\nContent-Transfer-Encoding: base64\n\n!!!"),
+		"bad gzip":         "\x1f\x8b\x00",
+		"gzip too large":   string(gzipped(t, strings.Repeat("a", cloudmeta.MaxUserDataSize+1))),
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse([]byte(data)); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	server := test.CreateMockAWSServer()
+	defer server.Close()
+
+	parts, err := Load(context.Background(), cloudmeta.NewAWSProvider(cloudmeta.WithBaseURL(server.URL)))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(parts) != 1 || string(parts[0].Body) != test.AWSUserData {
+		t.Errorf("Expected the mock user data, got %+v", parts)
+	}
+
+	server = test.CreateMockAWSServer(true)
+	defer server.Close()
+
+	_, err = Load(context.Background(), cloudmeta.NewAWSProvider(cloudmeta.WithBaseURL(server.URL), cloudmeta.WithRetry(cloudmeta.RetryPolicy{})))
+	if !errors.Is(err, cloudmeta.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+}
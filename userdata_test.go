@@ -0,0 +1,80 @@
+package cloudmeta
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeUserData(t *testing.T) {
+	const script = "#!/bin/sh\necho hello  \n\n"
+	encoded := base64.StdEncoding.EncodeToString([]byte(script))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		encoded bool
+		raw     bool
+		want    string
+	}{
+		{name: "plain", data: []byte(script), want: script},
+		{name: "gzip", data: gzipped(t, script), want: script},
+		{name: "base64", data: []byte(encoded), encoded: true, want: script},
+		{name: "base64 with newline", data: []byte(encoded + "\n"), encoded: true, want: script},
+		{
+			name:    "base64 gzip",
+			data:    []byte(base64.StdEncoding.EncodeToString(gzipped(t, script))),
+			encoded: true,
+			want:    script,
+		},
+		{name: "raw", data: []byte(encoded), encoded: true, raw: true, want: encoded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeUserData(tt.data, tt.encoded, tt.raw)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDecodeUserData_Errors(t *testing.T) {
+	if _, err := decodeUserData(nil, false, false); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for empty user data, got %v", err)
+	}
+	if _, err := decodeUserData([]byte("not base64!"), true, false); err == nil {
+		t.Error("Expected error for invalid base64")
+	}
+	if _, err := decodeUserData([]byte{0x1f, 0x8b, 0x00}, false, false); err == nil {
+		t.Error("Expected error for truncated gzip")
+	}
+
+	if _, err := decodeUserData(gzipped(t, strings.Repeat("a", MaxUserDataSize+1)), false, false); err == nil {
+		t.Error("Expected error for user data larger than MaxUserDataSize")
+	}
+	if _, err := decodeUserData(gzipped(t, strings.Repeat("a", MaxUserDataSize)), false, false); err != nil {
+		t.Errorf("Unexpected error for user data of MaxUserDataSize: %v", err)
+	}
+}